@@ -0,0 +1,54 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// copyAssets copies the files under src into dst, keeping their directories
+// and modes. Files whose copy has the same size and modification time are
+// skipped, so rebuilds only copy what changed.
+func copyAssets(src, dst string) error {
+	return filepath.Walk(src, func(filename string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, filename)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		}
+		// symlinked files are copied as the files they point to
+		if info, err = os.Stat(filename); err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		if copied, err := os.Stat(target); err == nil && copied.Size() == info.Size() && copied.ModTime().Equal(info.ModTime()) {
+			return nil
+		}
+		if err := copyFile(filename, target, info.Mode().Perm()); err != nil {
+			return err
+		}
+		return os.Chtimes(target, info.ModTime(), info.ModTime())
+	})
+}
+
+// copyFile writes the contents of src atomically into dst with mode
+func copyFile(src, dst string, mode os.FileMode) error {
+	err := writeFileAtomic(dst, func(w io.Writer) error {
+		in, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		_, err = io.Copy(w, in)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return os.Chmod(dst, mode)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCopyAssets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src, dst := path.Join(dir, "assets"), path.Join(dir, "output", "assets")
+	if err := os.MkdirAll(path.Join(src, "img"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, mode := range map[string]os.FileMode{"style.css": 0644, "img/logo.png": 0600, "run.sh": 0755} {
+		if err := ioutil.WriteFile(path.Join(src, name), []byte(name), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := copyAssets(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	for name, mode := range map[string]os.FileMode{"style.css": 0644, "img/logo.png": 0600, "run.sh": 0755} {
+		info, err := os.Stat(path.Join(dst, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != mode {
+			t.Errorf("%s: got mode %v; want %v", name, info.Mode().Perm(), mode)
+		}
+	}
+
+	// an unchanged asset isn't copied again, a changed one is, told apart
+	// by their sizes and modification times
+	if err := ioutil.WriteFile(path.Join(dst, "run.sh"), []byte("RUN.SH"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	srcInfo, _ := os.Stat(path.Join(src, "run.sh"))
+	os.Chtimes(path.Join(dst, "run.sh"), srcInfo.ModTime(), srcInfo.ModTime())
+	if err := ioutil.WriteFile(path.Join(dst, "style.css"), []byte("STYLE.CSS"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(path.Join(src, "style.css"), later, later)
+	if err := copyAssets(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"run.sh": "RUN.SH", "style.css": "style.css"} {
+		got, err := ioutil.ReadFile(path.Join(dst, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s: got %q; want %q", name, got, want)
+		}
+	}
+}
+
+func TestCopyAssetsAtomic(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("open files can't be replaced on windows")
+	}
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src, dst := path.Join(dir, "assets"), path.Join(dir, "output")
+	for _, d := range []string{src, dst} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(path.Join(src, "main.css"), []byte("new style"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(dst, "main.css"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// a reader of the old asset, e.g. a request served during a rebuild,
+	// keeps reading all of it instead of a truncated file
+	reader, err := os.Open(path.Join(dst, "main.css"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if err := copyAssets(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ioutil.ReadAll(reader); err != nil || string(got) != "old" {
+		t.Errorf("got %q, %v from the open asset; want %q", got, err, "old")
+	}
+	if got, err := ioutil.ReadFile(path.Join(dst, "main.css")); err != nil || string(got) != "new style" {
+		t.Errorf("got %q, %v; want %q", got, err, "new style")
+	}
+	if files, _ := ioutil.ReadDir(dst); len(files) != 1 {
+		t.Errorf("got %d files in the output; want only the asset", len(files))
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+)
+
+// Author is the author of the blog or of a post
+type Author struct {
+	Name  string
+	Email string
+}
+
+// readAuthor reads the author setting, either a name or a map with a name
+// and an optional email
+func readAuthor(v interface{}) (*Author, error) {
+	author := &Author{}
+	switch v := v.(type) {
+	case string:
+		author.Name = v
+	case map[interface{}]interface{}:
+		author.Name, _ = v["name"].(string)
+		author.Email, _ = v["email"].(string)
+	default:
+		return nil, fmt.Errorf("unexpected value %v", v)
+	}
+	if author.Name == "" {
+		return nil, fmt.Errorf("missing name")
+	}
+	return author, nil
+}
+
+// RSS formats the author for the RSS author and managingEditor elements,
+// "email (name)". RSS requires an email, it is empty without one.
+func (author *Author) RSS() string {
+	if author == nil || author.Email == "" {
+		return ""
+	}
+	return author.Email + " (" + author.Name + ")"
+}
+
+// Atom formats the author as an escaped Atom author element
+func (author *Author) Atom() string {
+	if author == nil {
+		return ""
+	}
+	var buf bytes.Buffer
+	buf.WriteString("<author><name>")
+	xml.EscapeText(&buf, []byte(author.Name))
+	buf.WriteString("</name>")
+	if author.Email != "" {
+		buf.WriteString("<email>")
+		xml.EscapeText(&buf, []byte(author.Email))
+		buf.WriteString("</email>")
+	}
+	buf.WriteString("</author>")
+	return buf.String()
+}
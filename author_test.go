@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestAuthorFormats(t *testing.T) {
+	index := &Index{config: defaultConfig()}
+	settings := strings.Replace(testSettings, "---\n", "---\nauthor:\n  name: Jane <Doe>\n  email: jane@example.com\n", 1)
+	if err := index.ReadFrontmatter([]byte(settings)); err != nil {
+		t.Fatal(err)
+	}
+
+	inherited := &Post{Index: index}
+	if err := inherited.Read(context.Background(), "a.md", []byte("---\ntitle: a\n---\nA.\n")); err != nil {
+		t.Fatal(err)
+	}
+	if want := "jane@example.com (Jane <Doe>)"; inherited.Author.RSS() != want {
+		t.Errorf("got RSS author %q; want %q", inherited.Author.RSS(), want)
+	}
+	if want := "<author><name>Jane &lt;Doe&gt;</name><email>jane@example.com</email></author>"; inherited.Author.Atom() != want {
+		t.Errorf("got Atom author %q; want %q", inherited.Author.Atom(), want)
+	}
+
+	// RSS needs an email, Atom only a name
+	own := &Post{Index: index}
+	if err := own.Read(context.Background(), "b.md", []byte("---\ntitle: b\nauthor: John\n---\nB.\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := own.Author.RSS(); got != "" {
+		t.Errorf("got RSS author %q; want none without an email", got)
+	}
+	if want := "<author><name>John</name></author>"; own.Author.Atom() != want {
+		t.Errorf("got Atom author %q; want %q", own.Author.Atom(), want)
+	}
+
+	// the example feed template omits the element without an author
+	tmpl := template.Must(template.New("").Parse("{{range .}}[{{with .Author.RSS}}<author>{{html .}}</author>{{end}}]{{end}}"))
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, []*Post{inherited, own, {Index: &Index{}}}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "[<author>jane@example.com (Jane &lt;Doe&gt;)</author>][][]"; buf.String() != want {
+		t.Errorf("got %q; want %q", buf.String(), want)
+	}
+
+	if err := own.Read(context.Background(), "c.md", []byte("---\ntitle: c\nauthor:\n  email: c@example.com\n---\nC.\n")); err == nil {
+		t.Error("got no error for an author without a name")
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newSyntheticSite writes a site of n posts into dir, two per day
+func newSyntheticSite(tb testing.TB, dir string, n int) *Config {
+	sources := make(map[string]string, n)
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		date := start.AddDate(0, 0, i/2).Format(shortTimeFormat)
+		sources[fmt.Sprintf("post-%04d.md", i)] = fmt.Sprintf("---\ntitle: Post %d\ndate: %s\n---\n%s\n", i, date, strings.Repeat("Some words in a paragraph. ", 50))
+	}
+	return newTestSite(tb, dir, sources)
+}
+
+func TestSyntheticSiteOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const n = 50
+	config := newSyntheticSite(t, dir, n)
+	generated, err := buildAll(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// n posts, index.html, index.xml, atom.xml and sitemap.xml
+	if len(generated) != n+4 {
+		t.Errorf("got %d generated files; want %d", len(generated), n+4)
+	}
+
+	// newest first, same-day posts in the order of their files
+	var want strings.Builder
+	for day := n/2 - 1; day >= 0; day-- {
+		fmt.Fprintf(&want, "Post %d\nPost %d\n", 2*day, 2*day+1)
+	}
+	got, err := ioutil.ReadFile(path.Join(config.OutputPath, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want.String() {
+		t.Errorf("got index %q; want %q", got, want.String())
+	}
+}
+
+func BenchmarkBuildAll(b *testing.B) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newSyntheticSite(b, dir, 1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := buildAll(context.Background(), config); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
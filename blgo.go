@@ -1,23 +1,43 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"flag"
 	"fmt"
+	"html"
+	htmltemplate "html/template"
+	"io"
 	"io/ioutil"
-	"log"
+	"mime"
 	"net/http"
+	"net/url"
 	"os"
+	"os/exec"
+	"os/signal"
 	"path"
 	"path/filepath"
+	"regexp"
+	"runtime"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"text/template"
+	"text/template/parse"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/BurntSushi/toml"
 	"github.com/fsnotify/fsnotify"
-	"github.com/otiai10/copy"
 	"github.com/russross/blackfriday"
 	yaml "gopkg.in/yaml.v2"
 )
@@ -29,212 +49,2043 @@ const (
 	indexTmplFilename = "index.tmpl.html"
 	feedTmplFilename  = "index.tmpl.xml"
 
+	// recentTmplFilename is only needed when Config.Recent is set
+	recentTmplFilename = "recent.tmpl.html"
+
 	settingsFilename = "_index.md"
+	latestFilename   = "latest.html"
+	manifestFilename = "asset-manifest.json"
+	archiveFilename  = "archive.html"
+	draftsFilename   = "drafts.xml"
+	recentFilename   = "recent.html"
+
+	// maxDescLength is the most bytes of the body used as the feed
+	// description of a post without an excerpt
+	maxDescLength = 200
+
+	// wordsPerMinute is the reading speed Post.ReadingTime is estimated at
+	wordsPerMinute = 200
+
+	moreMarker = "<!--more-->"
+	moreAnchor = "more"
+
+	excerptFrontmatter = "frontmatter"
+	excerptMore        = "more"
+	excerptParagraph   = "paragraph"
+
+	guidLink   = "link"
+	guidTagURI = "taguri"
+	guidHash   = "hash"
 )
 
+// Config holds the settings of a build, usually populated from flags
+type Config struct {
+	TemplatesPath string
+	OutputPath    string
+	SourcePath    string
+	AssetsPath    string
+	// DataPath is the directory of the data files exposed as Site.Data
+	DataPath string
+
+	// Latest enables generating a page that redirects to the newest post
+	Latest bool
+
+	// Fingerprint enables copying assets under content-hashed names
+	Fingerprint bool
+
+	// Preview is set when building for local preview, e.g. in watch mode
+	Preview bool
+
+	// Feeds names the generated feeds, keys of feedFormats
+	Feeds []string
+
+	// Drafts includes the draft posts in the build, which only happens by
+	// default in preview
+	Drafts bool
+
+	// OGImages enables generating an Open Graph image for posts without one
+	OGImages bool
+
+	// HomepageLimit caps the posts listed in index.html, the rest are listed
+	// in archive.html. Zero means no limit.
+	HomepageLimit int
+
+	// PerPage splits the posts listed in index.html into pages of this many,
+	// the rest in page/2.html, page/3.html and so on. Zero means a single
+	// page. It is ignored with a HomepageLimit.
+	PerPage int
+
+	// Recent is the number of newest posts listed in the recent.html fragment,
+	// for including in other pages. Zero disables it.
+	Recent int
+
+	// FeedBodyLimit is the maximum length of the HTML of Post.FeedBody, the
+	// content of full-content feeds. Longer posts are cut and link to the
+	// rest. Zero means no limit.
+	FeedBodyLimit int
+
+	// Excerpt lists the sources of a post's excerpt in order of precedence
+	Excerpt []string
+
+	// GUID is the scheme of the posts' GUIDs: link, taguri or hash. Only
+	// link GUIDs are permalinks, feeds mark the others with
+	// isPermaLink="false" by Post.GUIDPermaLink.
+	GUID string
+
+	// Shortcodes is what to do with unknown shortcodes in posts: keep or error
+	Shortcodes string
+
+	// StripTitleHeading removes the H1 a post's title is read from, when its
+	// frontmatter has none, from its body
+	StripTitleHeading bool
+
+	// AllowHTML renders the raw HTML of posts as is, otherwise posts are
+	// sanitized with an allowlist, e.g. for untrusted authors
+	AllowHTML bool
+
+	// IndexOnly skips writing the posts, only the pages listing them are built
+	IndexOnly bool
+
+	// LenientTemplates renders nothing in place of undefined templates
+	// instead of failing the build, e.g. while developing a theme
+	LenientTemplates bool
+
+	// UpdatedNow sets the index's update time to the time of the build
+	// instead of the date of the newest post
+	UpdatedNow bool
+
+	// Lenient builds markdown files without frontmatter, titled by their
+	// filename and dated by their modification time
+	Lenient bool
+
+	// AssetListing lists the files of asset directories in serve mode
+	AssetListing bool
+
+	// RendererCmd is a command rendering the posts with RendererExts instead
+	// of the markdown renderer. It reads a post's body from stdin and writes
+	// its HTML to stdout.
+	RendererCmd  string
+	RendererExts []string
+
+	// DistinctDates gives posts with the same date distinct feed dates in
+	// the order they are listed
+	DistinctDates bool
+
+	// HeadingPermalinks gives the headings of posts IDs and links to
+	// themselves
+	HeadingPermalinks bool
+
+	// CodeStyle highlights the code blocks of posts, and names the style of
+	// their stylesheet in the assets, e.g. "github". Empty disables it.
+	CodeStyle string
+
+	// LazyImages makes the images of posts load lazily, sized by their asset
+	// files when they have no width and height
+	LazyImages bool
+
+	// Strict turns warnings, e.g. about duplicate titles, into errors
+	Strict bool
+
+	// Gzip compresses the responses in serve mode for clients accepting gzip
+	Gzip bool
+
+	// Jobs is the number of posts read and written at once, zero means
+	// GOMAXPROCS
+	Jobs int
+
+	// PostsDir is the directory of the posts in the output and in their URLs
+	PostsDir string
+
+	// AssetsPrefix is the directory of the assets in the output and in their
+	// URLs
+	AssetsPrefix string
+
+	// Subdir nests the whole blog under a directory of the output and of
+	// the site's URL, e.g. to host a preview per branch
+	Subdir string
+}
+
+// sourceExts returns the extensions of the source files
+func (config *Config) sourceExts() []string {
+	exts := []string{".md"}
+	if config.RendererCmd != "" {
+		for _, ext := range config.RendererExts {
+			if ext != ".md" {
+				exts = append(exts, ext)
+			}
+		}
+	}
+	return exts
+}
+
+// rendersExternally reports whether filename is rendered by RendererCmd
+func (config *Config) rendersExternally(filename string) bool {
+	if config.RendererCmd == "" {
+		return false
+	}
+	for _, ext := range config.RendererExts {
+		if filepath.Ext(filename) == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// link returns the path of elem on the site, under the base path and the
+// subdirectory
+func (index *Index) link(elem ...string) string {
+	return path.Join(append([]string{"/", index.basePath, index.settings().Subdir}, elem...)...)
+}
+
+// assetsURL returns the path the assets are linked with
+func (index *Index) assetsURL() string {
+	return index.link(index.settings().AssetsPrefix)
+}
+
+// imageURL returns the absolute URL of the image of a post. A path is
+// relative to the assets root, e.g. cover.png, unless it starts with a slash.
+func (index *Index) imageURL(image string) (string, error) {
+	ref, err := url.Parse(image)
+	if err != nil {
+		return "", err
+	}
+	if !ref.IsAbs() && ref.Host == "" && !strings.HasPrefix(ref.Path, "/") {
+		ref.Path = path.Join(index.assetsURL(), ref.Path)
+	}
+	base, err := url.Parse(index.URL)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// jobs returns the number of posts to read or write at once
+func (config *Config) jobs() int {
+	if config.Jobs > 0 {
+		return config.Jobs
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// outputAssetsPath returns the directory of the assets in the output, which
+// also has the generated ones, e.g. the hashed names and the code stylesheet
+func (config *Config) outputAssetsPath() string {
+	return path.Join(config.OutputPath, config.Subdir, config.AssetsPrefix)
+}
+
+// assetsURL returns the path the assets are served under, in the output
+func (config *Config) assetsURL() string {
+	return path.Join("/", config.Subdir, config.AssetsPrefix)
+}
+
+// defaultConfig returns the settings used when none are specified
+func defaultConfig() *Config {
+	return &Config{
+		Excerpt:           []string{excerptFrontmatter, excerptMore, excerptParagraph},
+		GUID:              guidLink,
+		Shortcodes:        shortcodesKeep,
+		StripTitleHeading: true,
+		AllowHTML:         true,
+		RendererExts:      []string{".md"},
+		PostsDir:          "post",
+		Feeds:             []string{"rss", "atom"},
+		AssetsPrefix:      "assets",
+		Gzip:              true,
+	}
+}
+
 // Post represents a single blog post
 type Post struct {
 	Index          *Index
 	Slug           string
 	OutputFilename string
-	Body           string
+	Body           htmltemplate.HTML
+	BodyLength     int
+	TextLength     int
+	WordCount      int
+	ReadingTime    int // in minutes, at wordsPerMinute
 	Date           time.Time
+	FeedDate       time.Time
+	Updated        time.Time
 	Description    string
+	Excerpt        string
+	Summary        htmltemplate.HTML
+	FeedBody       string
 	GUID           string
+	GUIDPermaLink  bool
 	Link           string
+	Canonical      string
+	Image          string // absolute URL, from a path relative to the assets root or a URL
+	Robots         string
+	Tags           []string
+	Author         *Author
+	Headings       []Heading
+	TOC            htmltemplate.HTML
 	RelativeLink   string
+	ReadMoreLink   string
 	Title          string
 	XMLDesc        string
 	XMLTitle       string
 	Draft          bool
+	// Prev and Next are the published posts before and after this one, nil
+	// for the oldest and the newest
+	Prev *Post
+	Next *Post
+	// Params holds the whole frontmatter, e.g. {{index .Params "subtitle"}}
+	// for keys without a field
+	Params map[string]interface{}
+	// Menu is the title of the post in Site.Menu, empty to leave it out
+	Menu       string
+	MenuWeight int
+
+	filename string
+	// dir is the subdirectory of the source the post is in, e.g. "2023"
+	dir string
 }
 
 // ReadFile will fill the post from given filename
-func (p *Post) ReadFile(filename string) error {
+func (p *Post) ReadFile(ctx context.Context, filename string) error {
 	body, err := ioutil.ReadFile(filename)
 	if err == nil {
-		return p.Read(filename, body)
+		return p.Read(ctx, filename, body)
 	}
 	return err
 }
 
-// Read will fill the post from given byte string
-func (p *Post) Read(filename string, body []byte) error {
-	var title string
-	var draft bool
-	var date time.Time
-	var err error
+// Read will fill the post from given byte string. Canceling ctx stops an
+// external renderer.
+func (p *Post) Read(ctx context.Context, filename string, body []byte) error {
+	var title, description, canonical, image, robots string
+	var draft bool
+	var date time.Time
+	var err error
+
+	// in lenient mode files without frontmatter are plain markdown
+	frontmatter, err := parseFrontmatter(&body)
+	bare := err == errNoFrontmatter && p.Index.settings().Lenient
+	if bare {
+		frontmatter = make(map[string]interface{})
+	} else if err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+
+	if err := validateFrontmatter(p.Index.schema, p.Index.dateFormats(), frontmatter); err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+
+	if v, ok := frontmatter["title"]; ok {
+		if title, ok = v.(string); !ok {
+			return fmt.Errorf("%s: invalid title: expected a string, got %v", filename, v)
+		}
+	} else if heading, start, end, ok := titleHeading(body); ok {
+		title = heading
+		if p.Index.settings().StripTitleHeading {
+			body = append(body[:start:start], body[end:]...)
+		}
+	} else if bare {
+		title = slugify(strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename)))
+	} else {
+		return fmt.Errorf("%s: could not read the title from post", filename)
+	}
+
+	if v, ok := frontmatter["description"]; ok {
+		if description, ok = v.(string); !ok {
+			return fmt.Errorf("%s: invalid description: expected a string, got %v", filename, v)
+		}
+	}
+
+	if v, ok := frontmatter["canonical"]; ok {
+		if canonical, ok = v.(string); !ok {
+			return fmt.Errorf("%s: invalid canonical: expected a string, got %v", filename, v)
+		}
+		if err := validateAbsoluteURL("canonical", canonical); err != nil {
+			return fmt.Errorf("%s: %v", filename, err)
+		}
+	}
+
+	for _, key := range []string{"image", "cover"} {
+		if v, ok := frontmatter[key]; ok {
+			s, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("%s: invalid %s: expected a string, got %v", filename, key, v)
+			}
+			if image, err = p.Index.imageURL(s); err != nil {
+				return fmt.Errorf("%s: invalid %s: %v", filename, key, err)
+			}
+			break
+		}
+	}
+
+	if v, ok := frontmatter["robots"]; ok {
+		if robots, ok = v.(string); !ok {
+			return fmt.Errorf("%s: invalid robots: expected a string, got %v", filename, v)
+		}
+	}
+
+	// posts are by the author of the blog unless they say otherwise
+	author := p.Index.Author
+	if v, ok := frontmatter["author"]; ok {
+		if author, err = readAuthor(v); err != nil {
+			return fmt.Errorf("%s: invalid author: %v", filename, err)
+		}
+	}
+
+	// tags is either a list or a single tag
+	var tags []string
+	switch v := frontmatter["tags"].(type) {
+	case []interface{}:
+		for _, tag := range v {
+			tags = append(tags, fmt.Sprint(tag))
+		}
+	case string:
+		tags = []string{v}
+	}
+
+	draft = p.Index.defaultDraft
+	if v, ok := frontmatter["draft"]; ok {
+		if draft, ok = v.(bool); !ok {
+			return fmt.Errorf("%s: invalid draft: expected a bool, got %v", filename, v)
+		}
+	}
+
+	toc := p.Index.toc
+	if v, ok := frontmatter["toc"]; ok {
+		if toc, ok = v.(bool); !ok {
+			return fmt.Errorf("%s: invalid toc: expected a bool, got %v", filename, v)
+		}
+	}
+
+	menuTitle, menuWeight, err := readMenu(frontmatter, title)
+	if err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+
+	if v, ok := frontmatter["date"]; ok {
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s: invalid date: expected a date, got %v", filename, v)
+		}
+		if date, err = parseDate(s, p.Index.dateFormats()); err != nil {
+			return fmt.Errorf("%s: %v", filename, err)
+		}
+	} else if bare {
+		if stat, err := os.Stat(filename); err == nil {
+			date = stat.ModTime()
+		}
+	}
+
+	// posts are as new as their publish date until revised
+	updated := date
+	if v, ok := frontmatter["updated"]; ok {
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s: invalid updated: expected a date, got %v", filename, v)
+		}
+		if updated, err = parseDate(s, p.Index.dateFormats()); err != nil {
+			return fmt.Errorf("%s: invalid updated: %v", filename, err)
+		}
+	}
+
+	expanded, err := expandShortcodes(body, p.Index.settings().Shortcodes)
+	if err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	// a custom delimiter may not survive rendering, split on the source
+	if delim := p.Index.excerptDelimiter; delim != "" && delim != moreMarker {
+		expanded = bytes.Replace(expanded, []byte(delim), []byte(moreMarker), 1)
+	}
+	var rendered []byte
+	var headings []Heading
+	if p.Index.settings().rendersExternally(filename) {
+		if rendered, err = runRenderer(ctx, p.Index.settings().RendererCmd, expanded); err != nil {
+			return fmt.Errorf("%s: %v", filename, err)
+		}
+	} else {
+		// the table of contents links to the headings by their IDs
+		rendered, headings = renderPost(expanded, p.Index.settings(), toc)
+	}
+	// anchor the split point so "read more" continues after the excerpt
+	var readMore bool
+	var summary string
+	if i := bytes.Index(rendered, []byte(moreMarker)); i >= 0 {
+		rendered = append(rendered[:i:i], append([]byte(`<span id="`+moreAnchor+`"></span>`), rendered[i+len(moreMarker):]...)...)
+		readMore = true
+		// closing the elements open at the split point
+		summary, _ = truncateHTML(string(rendered), i)
+	}
+	if !p.Index.settings().AllowHTML {
+		rendered = htmlPolicy.SanitizeBytes(rendered)
+		summary = htmlPolicy.Sanitize(summary)
+	}
+	if summary == "" {
+		summary = readSummary(rendered)
+	}
+	if p.Index.settings().LazyImages {
+		rendered = lazyImages(p.Index, rendered)
+	}
+	excerpt, err := readExcerpt(p.Index.settings().Excerpt, description, expanded)
+	if err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+
+	var descBuf, titleBuf bytes.Buffer
+	// an explicit description wins over the excerpt sources
+	if description != "" {
+		xml.EscapeText(&descBuf, []byte(description))
+	} else if excerpt != "" {
+		xml.EscapeText(&descBuf, []byte(excerpt))
+	} else {
+		// back up to a rune boundary so the description stays valid UTF-8
+		n := len(body)
+		if n > maxDescLength {
+			n = maxDescLength
+			for n > 0 && !utf8.RuneStart(body[n]) {
+				n--
+			}
+		}
+		xml.EscapeText(&descBuf, bytes.Trim(body[:n], " \n\r"))
+	}
+	xml.EscapeText(&titleBuf, []byte(title))
+
+	postsDir := p.Index.settings().PostsDir
+	p.filename = filename
+	p.Slug = path.Join(p.dir, strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename)))
+	p.OutputFilename = path.Join(postsDir, p.Slug+".html")
+	p.Body = htmltemplate.HTML(rendered)
+	p.Description = description
+	p.Excerpt = excerpt
+	p.Summary = htmltemplate.HTML(summary)
+	p.Title = title
+	p.Date = date
+	p.FeedDate = date
+	p.Updated = updated
+	p.Link = strings.TrimSuffix(p.Index.URL, "/") + "/" + path.Join(postsDir, p.Slug)
+	p.RelativeLink = p.Index.link(postsDir, p.Slug)
+	p.ReadMoreLink = p.RelativeLink
+	p.Canonical = p.Link
+	if canonical != "" {
+		p.Canonical = canonical
+	}
+	p.Image = image
+	p.Robots = robots
+	p.Tags = tags
+	p.Params = frontmatter
+	p.Menu = menuTitle
+	p.MenuWeight = menuWeight
+	if p.GUID, err = p.guid(p.Index.settings().GUID, body); err != nil {
+		return err
+	}
+	p.GUIDPermaLink = p.GUID == p.Link
+	if readMore {
+		p.ReadMoreLink += "#" + moreAnchor
+	}
+	// for content stats, bytes of HTML and characters of text
+	p.BodyLength = len(p.Body)
+	text := plaintext(rendered)
+	p.TextLength = utf8.RuneCountInString(text)
+	p.WordCount = len(strings.Fields(text))
+	p.ReadingTime = (p.WordCount + wordsPerMinute - 1) / wordsPerMinute
+	p.Headings = headings
+	p.TOC = ""
+	if toc {
+		p.TOC = htmltemplate.HTML(tableOfContents(headings))
+	}
+	p.Author = author
+	// feed readers resolve fragments against the feed, not the post
+	p.FeedBody = string(p.Body)
+	if strings.Contains(p.FeedBody, `href="#`) {
+		p.FeedBody = strings.Replace(p.FeedBody, `href="#`, `href="`+html.EscapeString(p.Canonical)+`#`, -1)
+	}
+	if limit := p.Index.settings().FeedBodyLimit; limit > 0 {
+		if truncated, ok := truncateHTML(p.FeedBody, limit); ok {
+			p.FeedBody = truncated + `<p><a href="` + html.EscapeString(p.Canonical) + `">Read more</a></p>`
+		}
+	}
+	p.XMLDesc = descBuf.String()
+	p.XMLTitle = titleBuf.String()
+	p.Draft = draft
+
+	return nil
+}
+
+// NoIndex reports whether the robots directives of the post forbid indexing
+func (p *Post) NoIndex() bool {
+	for _, directive := range strings.Split(p.Robots, ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "noindex", "none":
+			return true
+		}
+	}
+	return false
+}
+
+// TwitterCard returns the Twitter Card type of the post, with a large image
+// if it has one
+func (p *Post) TwitterCard() string {
+	if p.Image != "" {
+		return "summary_large_image"
+	}
+	return "summary"
+}
+
+// guid returns the GUID of the post in the given scheme, body is its source
+func (p *Post) guid(scheme string, body []byte) (string, error) {
+	switch scheme {
+	case guidLink:
+		return p.Link, nil
+	case guidTagURI:
+		// RFC 4151, e.g. tag:example.com,2017-01-21:/post/context
+		u, err := url.Parse(p.Index.URL)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("tag:%s,%s:%s", u.Hostname(), p.Date.Format(shortTimeFormat), p.RelativeLink), nil
+	case guidHash:
+		sum := sha256.Sum256(body)
+		return hex.EncodeToString(sum[:]), nil
+	}
+	return "", fmt.Errorf("unknown GUID scheme %q", scheme)
+}
+
+var h1Re = regexp.MustCompile(`^#[ \t]+(.*?)(?:[ \t]+#+)?[ \t]*$`)
+
+// titleHeading returns the text of the first H1 of the markdown body and the
+// offsets of its line, fenced code blocks are skipped
+func titleHeading(body []byte) (title string, start, end int, ok bool) {
+	var fence string
+	for start < len(body) {
+		end = start + bytes.IndexByte(body[start:], '\n') + 1
+		if end == start {
+			end = len(body)
+		}
+		line := strings.TrimRight(string(body[start:end]), "\r\n")
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+		case strings.HasPrefix(trimmed, "```"), strings.HasPrefix(trimmed, "~~~"):
+			fence = trimmed[:3]
+		default:
+			if m := h1Re.FindStringSubmatch(line); m != nil {
+				return plaintext(renderMarkdown([]byte(m[1]))), start, end, true
+			}
+		}
+		start = end
+	}
+	return "", 0, 0, false
+}
+
+var (
+	paragraphRe = regexp.MustCompile(`(?s)<p>(.*?)</p>`)
+)
+
+// readExcerpt returns the plaintext excerpt from the first of the given
+// sources that yields one. body is the markdown of the post.
+func readExcerpt(sources []string, description string, body []byte) (string, error) {
+	for _, source := range sources {
+		var excerpt string
+		switch source {
+		case excerptFrontmatter:
+			excerpt = description
+		case excerptMore:
+			if i := bytes.Index(body, []byte(moreMarker)); i >= 0 {
+				excerpt = plaintext(renderMarkdown(body[:i]))
+			}
+		case excerptParagraph:
+			excerpt = plaintext(renderMarkdown(firstBlock(body)))
+		default:
+			return "", fmt.Errorf("unknown excerpt source %q", source)
+		}
+		if excerpt = strings.TrimSpace(excerpt); excerpt != "" {
+			return excerpt, nil
+		}
+	}
+	return "", nil
+}
+
+// firstBlock returns the markdown body up to its first blank line, skipping
+// the blank lines it starts with
+func firstBlock(body []byte) []byte {
+	start := -1
+	for i := 0; i < len(body); {
+		end := bytes.IndexByte(body[i:], '\n') + 1
+		if end == 0 {
+			end = len(body)
+		} else {
+			end += i
+		}
+		blank := len(bytes.TrimSpace(body[i:end])) == 0
+		if !blank && start < 0 {
+			start = i
+		} else if blank && start >= 0 {
+			return body[start:i]
+		}
+		i = end
+	}
+	if start < 0 {
+		return nil
+	}
+	return body[start:]
+}
+
+// readSummary returns the first paragraph of rendered, or else its first
+// maxDescLength bytes
+func readSummary(rendered []byte) string {
+	if m := paragraphRe.Find(rendered); m != nil {
+		return string(m)
+	}
+	summary, _ := truncateHTML(string(rendered), maxDescLength)
+	return summary
+}
+
+// plaintext strips the tags from rendered HTML and collapses whitespace
+func plaintext(rendered []byte) string {
+	// strip the tags and collapse in single passes, this runs for every post
+	stripped := make([]byte, 0, len(rendered))
+	for len(rendered) > 0 {
+		i := bytes.IndexByte(rendered, '<')
+		if i < 0 {
+			stripped = append(stripped, rendered...)
+			break
+		}
+		stripped = append(stripped, rendered[:i]...)
+		j := bytes.IndexByte(rendered[i:], '>')
+		if j < 0 {
+			// an unclosed < is text
+			stripped = append(stripped, rendered[i:]...)
+			break
+		}
+		rendered = rendered[i+j+1:]
+	}
+
+	var b strings.Builder
+	b.Grow(len(stripped))
+	space := false
+	for _, r := range html.UnescapeString(string(stripped)) {
+		if unicode.IsSpace(r) {
+			space = b.Len() > 0
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// renderMarkdown renders a post's markdown body to HTML
+func renderMarkdown(body []byte) []byte {
+	return blackfriday.MarkdownOptions(body, newRenderer(), blackfriday.Options{Extensions: commonExtensions})
+}
+
+// renderPost renders the body of a post like renderMarkdown and returns its
+// headings. With ids each heading gets an ID, with the HeadingPermalinks of
+// config an ID and a link to itself. Code is highlighted with a CodeStyle.
+func renderPost(body []byte, config *Config, ids bool) ([]byte, []Heading) {
+	var headings []Heading
+	r := newRenderer()
+	r.permalinks = config.HeadingPermalinks
+	r.headings = &headings
+	r.highlight = config.CodeStyle != ""
+	extensions := commonExtensions
+	if r.permalinks || ids {
+		extensions |= blackfriday.EXTENSION_AUTO_HEADER_IDS
+	}
+	return blackfriday.MarkdownOptions(body, r, blackfriday.Options{Extensions: extensions}), headings
+}
+
+// Index represents global settings/variables and the index of the posts
+// the index.html will generated from Index
+type Index struct {
+	Title     string
+	Posts     []*Post
+	URL       string
+	XMLURL    string
+	UpdatedAt time.Time
+	Image     *FeedImage
+	Author    *Author
+	Site      Site
+	Params    map[string]interface{}
+
+	// Tag is the tag of the posts listed on a tag page
+	Tag string
+
+	// Pagination is the page of the index listed, nil unless paginated
+	Pagination *Pagination
+
+	config  *Config
+	schema  map[string]fieldSchema
+	sitemap sitemapSettings
+
+	// taxonomies holds the settings of the taxonomy pages by taxonomy
+	taxonomies map[string]taxonomySettings
+
+	// defaultDraft is the draft state of posts without a draft key
+	defaultDraft bool
+
+	// toc enables the table of contents of posts without a toc key
+	toc bool
+
+	// basePath is the path of the site on its host, e.g. "/blog", prefixing
+	// the links of the posts, tags and assets. It is empty at the root.
+	basePath string
+
+	// dateFormat is the layout of the dates of posts, replacing dateFormats,
+	// e.g. "02/01/2006"
+	dateFormat string
+
+	// excerptDelimiter is a token splitting the excerpt from the rest of a
+	// post like moreMarker, e.g. "<!-- more -->"
+	excerptDelimiter string
+}
+
+// Site describes the build of the blog, e.g. for a "last built" footer
+type Site struct {
+	BuildTime time.Time
+	// Commit is the commit of the source, empty outside a git repository
+	Commit string
+	// Data holds the data files by name, e.g. .Site.Data.nav for data/nav.yaml
+	Data map[string]interface{}
+	// Menu lists the posts with a menu key by their menu_weight
+	Menu []MenuItem
+}
+
+// FeedImage is the logo of the feed channel
+type FeedImage struct {
+	URL    string
+	Title  string
+	Link   string
+	Width  int
+	Height int
+}
+
+// maximum dimensions of a channel image recommended by RSS 2.0
+const (
+	maxFeedImageWidth  = 144
+	maxFeedImageHeight = 400
+)
+
+// settings returns the config of the build the index belongs to
+func (index *Index) settings() *Config {
+	if index.config == nil {
+		return defaultConfig()
+	}
+	return index.config
+}
+
+func (index *Index) Len() int           { return len(index.Posts) }
+func (index *Index) Swap(i, j int)      { index.Posts[i], index.Posts[j] = index.Posts[j], index.Posts[i] }
+func (index *Index) Less(i, j int) bool { return index.Posts[i].Date.Before(index.Posts[j].Date) }
+
+// Latest returns the newest non-draft post, or nil if there is none.
+// Posts must already be sorted newest first.
+func (index *Index) Latest() *Post {
+	for _, post := range index.Posts {
+		if !post.Draft {
+			return post
+		}
+	}
+	return nil
+}
+
+// ReadFrontmatterFile will fill the index frontmatter from given filename
+func (index *Index) ReadFrontmatterFile(filename string) error {
+	body, err := ioutil.ReadFile(filename)
+	if err == nil {
+		return index.ReadFrontmatter(body)
+	}
+	return err
+}
+
+// ReadFrontmatter will fill the index frontmatter from given data
+func (index *Index) ReadFrontmatter(body []byte) error {
+	indexFrontmatter, err := parseFrontmatter(&body)
+	if err != nil {
+		return err
+	}
+
+	for _, field := range []struct {
+		key   string
+		value *string
+	}{
+		{"title", &index.Title},
+		{"url", &index.URL},
+		{"xmlurl", &index.XMLURL},
+	} {
+		v, ok := indexFrontmatter[field.key]
+		if !ok {
+			return fmt.Errorf("missing %s", field.key)
+		}
+		if *field.value, ok = v.(string); !ok {
+			return fmt.Errorf("invalid %s: expected a string, got %v", field.key, v)
+		}
+	}
+	index.UpdatedAt = time.Now()
+
+	if err := validateAbsoluteURL("url", index.URL); err != nil {
+		return err
+	}
+	if err := validateAbsoluteURL("xmlurl", index.XMLURL); err != nil {
+		return err
+	}
+	// links are under the path of the URL, e.g. /blog, unless told otherwise
+	u, err := url.Parse(index.URL)
+	if err != nil {
+		return err
+	}
+	index.basePath = strings.TrimSuffix(u.Path, "/")
+	if v, ok := indexFrontmatter["basepath"]; ok {
+		basePath, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("invalid basepath: expected a string, got %v", v)
+		}
+		index.basePath = strings.TrimSuffix(path.Clean("/"+basePath), "/")
+	}
+
+	if subdir := index.settings().Subdir; subdir != "" {
+		url := strings.TrimSuffix(index.URL, "/") + "/" + subdir + "/"
+		if strings.HasPrefix(index.XMLURL, index.URL) {
+			index.XMLURL = url + strings.TrimPrefix(index.XMLURL[len(index.URL):], "/")
+		}
+		index.URL = url
+	}
+
+	if v, ok := indexFrontmatter["params"]; ok {
+		params, ok := v.(map[interface{}]interface{})
+		if !ok {
+			return fmt.Errorf("invalid params: expected a map, got %v", v)
+		}
+		index.Params = make(map[string]interface{}, len(params))
+		for key, value := range params {
+			index.Params[fmt.Sprint(key)] = value
+		}
+	}
+
+	if v, ok := indexFrontmatter["sitemap"]; ok {
+		if index.sitemap, err = readSitemapSettings(v); err != nil {
+			return fmt.Errorf("invalid sitemap: %v", err)
+		}
+	}
+
+	if v, ok := indexFrontmatter["author"]; ok {
+		if index.Author, err = readAuthor(v); err != nil {
+			return fmt.Errorf("invalid author: %v", err)
+		}
+	}
+
+	if v, ok := indexFrontmatter["default_draft"]; ok {
+		if index.defaultDraft, ok = v.(bool); !ok {
+			return fmt.Errorf("invalid default_draft: expected a bool, got %v", v)
+		}
+	}
+
+	if v, ok := indexFrontmatter["toc"]; ok {
+		if index.toc, ok = v.(bool); !ok {
+			return fmt.Errorf("invalid toc: expected a bool, got %v", v)
+		}
+	}
+
+	if v, ok := indexFrontmatter["dateformat"]; ok {
+		if index.dateFormat, ok = v.(string); !ok || index.dateFormat == "" {
+			return fmt.Errorf("invalid dateformat: expected a non-empty string, got %v", v)
+		}
+	}
+
+	if v, ok := indexFrontmatter["excerpt_delimiter"]; ok {
+		if index.excerptDelimiter, ok = v.(string); !ok || strings.TrimSpace(index.excerptDelimiter) == "" {
+			return fmt.Errorf("invalid excerpt_delimiter: expected a non-empty string, got %v", v)
+		}
+	}
+
+	if v, ok := indexFrontmatter["taxonomies"]; ok {
+		if index.taxonomies, err = readTaxonomySettings(v); err != nil {
+			return fmt.Errorf("invalid taxonomies: %v", err)
+		}
+	}
+
+	if v, ok := indexFrontmatter["schema"]; ok {
+		if index.schema, err = readSchema(v); err != nil {
+			return fmt.Errorf("invalid schema: %v", err)
+		}
+	}
+
+	for _, key := range []string{"image", "logo"} {
+		if v, ok := indexFrontmatter[key]; ok {
+			if index.Image, err = index.readFeedImage(v); err != nil {
+				return fmt.Errorf("invalid %s: %v", key, err)
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// readFeedImage reads the channel image setting, which is either the image
+// URL or a map with url, width and height keys
+func (index *Index) readFeedImage(v interface{}) (*FeedImage, error) {
+	image := &FeedImage{Title: index.Title, Link: index.URL}
+	switch v := v.(type) {
+	case string:
+		image.URL = v
+	case map[interface{}]interface{}:
+		image.URL, _ = v["url"].(string)
+		image.Width, _ = v["width"].(int)
+		image.Height, _ = v["height"].(int)
+	default:
+		return nil, fmt.Errorf("unexpected value %v", v)
+	}
+	if image.URL == "" {
+		return nil, fmt.Errorf("missing url")
+	}
+
+	// relative image URLs are relative to the blog
+	base, err := url.Parse(index.URL)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := url.Parse(image.URL)
+	if err != nil {
+		return nil, err
+	}
+	image.URL = base.ResolveReference(ref).String()
+
+	if image.Width > maxFeedImageWidth || image.Height > maxFeedImageHeight {
+		logger.Infof("warning: feed image is %dx%d, RSS recommends at most %dx%d", image.Width, image.Height, maxFeedImageWidth, maxFeedImageHeight)
+	}
+	return image, nil
+}
+
+// validateAbsoluteURL returns an error if value is not an absolute http(s) URL
+func validateAbsoluteURL(key, value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %v", key, value, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid %s %q: scheme must be http or https", key, value)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid %s %q: missing host", key, value)
+	}
+	return nil
+}
+
+// errors of parseFrontmatter for bodies without frontmatter and with
+// frontmatter that never ends
+var (
+	errNoFrontmatter       = errors.New("missing frontmatter delimiter")
+	errUnclosedFrontmatter = errors.New("missing closing frontmatter delimiter")
+)
+
+// parseFrontmatter parses the frontmatter at the start of body and leaves
+// the rest in body. It is YAML between --- lines, TOML between +++ lines or
+// a JSON object. The values are those of YAML either way, e.g. int and
+// map[interface{}]interface{}, so posts read them the same.
+func parseFrontmatter(body *[]byte) (map[string]interface{}, error) {
+	frontmatter := make(map[string]interface{})
+	if isJSONFrontmatter(*body) {
+		dec := json.NewDecoder(bytes.NewReader(*body))
+		dec.UseNumber()
+		if err := dec.Decode(&frontmatter); err != nil {
+			return nil, err
+		}
+		rest := (*body)[dec.InputOffset():]
+		rest = bytes.TrimPrefix(bytes.TrimPrefix(rest, []byte("\r")), []byte("\n"))
+		*body = rest
+		return yamlValues(frontmatter), nil
+	}
+
+	var frontmatterBuf bytes.Buffer
+	buf := bytes.NewBuffer(*body)
+	delim := ""
+	for {
+		line, err := buf.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		// the closing delimiter may end the file without a newline
+		trimmed := strings.TrimRight(line, "\r\n")
+		if delim == "" && (trimmed == "---" || trimmed == "+++") {
+			delim = trimmed
+		} else if delim == "" && strings.TrimSpace(line) != "" {
+			// only the first non-empty line opens frontmatter, a later ---
+			// is a horizontal rule
+			return nil, errNoFrontmatter
+		} else if delim != "" && trimmed == delim {
+			break
+		} else if delim != "" {
+			frontmatterBuf.WriteString(line)
+		}
+
+		if err == io.EOF {
+			if delim == "" {
+				return nil, errNoFrontmatter
+			}
+			return nil, errUnclosedFrontmatter
+		}
+	}
+
+	*body = buf.Bytes() // rest of the bytes
+	if delim == "+++" {
+		if err := toml.Unmarshal(frontmatterBuf.Bytes(), &frontmatter); err != nil {
+			return nil, err
+		}
+		return yamlValues(frontmatter), nil
+	}
+	return frontmatter, yaml.Unmarshal(frontmatterBuf.Bytes(), &frontmatter)
+}
+
+// isJSONFrontmatter reports whether body starts with a JSON object, whose
+// brace is followed by a space or a key, unlike e.g. a shortcode like
+// {{< youtube id >}}
+func isJSONFrontmatter(body []byte) bool {
+	body = bytes.TrimLeft(body, " \t\r\n")
+	if len(body) < 2 || body[0] != '{' {
+		return false
+	}
+	switch body[1] {
+	case ' ', '\t', '\r', '\n', '"', '}':
+		return true
+	}
+	return false
+}
+
+// yamlValues converts the values of frontmatter with yamlValue
+func yamlValues(frontmatter map[string]interface{}) map[string]interface{} {
+	for key, value := range frontmatter {
+		frontmatter[key] = yamlValue(value)
+	}
+	return frontmatter
+}
+
+// yamlValue converts a value decoded from TOML or JSON to the value YAML
+// decodes from the same text: nested maps have interface{} keys, whole
+// numbers are ints and dates are strings like those in YAML frontmatter.
+func yamlValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[interface{}]interface{}, len(v))
+		for key, value := range v {
+			m[key] = yamlValue(value)
+		}
+		return m
+	case []interface{}:
+		for i := range v {
+			v[i] = yamlValue(v[i])
+		}
+		return v
+	case int64:
+		return int(v)
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return int(n)
+		}
+		f, _ := v.Float64()
+		return f
+	case time.Time:
+		if v.Hour() == 0 && v.Minute() == 0 && v.Second() == 0 && v.Nanosecond() == 0 {
+			return v.Format(shortTimeFormat)
+		}
+		return v.Format(time.RFC3339)
+	}
+	return v
+}
+
+// listSourceFiles lists files that has one of the extensions in specified path
+// and its subdirectories, except hidden ones. The path may be a symlink, the
+// files are listed under it all the same.
+func listSourceFiles(sourcePath string, exts []string) (filenames []string, err error) {
+	// a cyclic symlink is an error here rather than an empty listing
+	resolved, err := filepath.EvalSymlinks(sourcePath)
+	if err != nil {
+		return nil, err
+	}
+	// Walk doesn't follow the symlinks below, so it can't loop
+	err = filepath.Walk(resolved, func(filename string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if filename != resolved && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		for _, ext := range exts {
+			if strings.HasSuffix(info.Name(), ext) {
+				rel, err := filepath.Rel(resolved, filename)
+				if err != nil {
+					return err
+				}
+				filenames = append(filenames, path.Join(sourcePath, filepath.ToSlash(rel)))
+				break
+			}
+		}
+		return nil
+	})
+	sort.Strings(filenames)
+	return
+}
+
+// hasSourceExt reports whether filename has the extension of a source file
+func hasSourceExt(config *Config, filename string) bool {
+	for _, ext := range config.sourceExts() {
+		if strings.HasSuffix(filename, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// watchDirs adds dir and its directories to watcher, skipping hidden ones
+// like listSourceFiles
+func watchDirs(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.Walk(dir, func(filename string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return err
+		}
+		if filename != dir && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		logger.Info("adding", filename)
+		return watcher.Add(filename)
+	})
+}
+
+// listFiles lists the regular files under root, relative to root
+func listFiles(root string) (filenames []string, err error) {
+	err = filepath.Walk(root, func(filename string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(root, filename)
+		if err != nil {
+			return err
+		}
+		filenames = append(filenames, filepath.ToSlash(rel))
+		return nil
+	})
+	return
+}
+
+// lastUpdated returns the date of the newest non-draft post, or the zero
+// time if there is none
+func (index *Index) lastUpdated() time.Time {
+	var updated time.Time
+	for _, post := range index.Posts {
+		if !post.Draft && post.Updated.After(updated) {
+			updated = post.Updated
+		}
+	}
+	return updated
+}
+
+// linkNeighbors points the Prev and Next of the published posts to the ones
+// published before and after them. The posts must be sorted newest first.
+func (index *Index) linkNeighbors() {
+	var newer *Post
+	for _, post := range index.Posts {
+		post.Prev, post.Next = nil, nil
+		if post.Draft {
+			continue
+		}
+		if newer != nil {
+			newer.Prev = post
+			post.Next = newer
+		}
+		newer = post
+	}
+}
+
+// distinctFeedDates spaces the feed dates of posts with the same date a minute
+// apart, later for the ones listed first, so feed readers keep their order.
+// The posts must be sorted newest first.
+func (index *Index) distinctFeedDates() {
+	for i := 0; i < len(index.Posts); {
+		j := i + 1
+		for j < len(index.Posts) && index.Posts[j].Date.Equal(index.Posts[i].Date) {
+			j++
+		}
+		for k, post := range index.Posts[i:j] {
+			post.FeedDate = post.Date.Add(time.Duration(j-i-1-k) * time.Minute)
+			// never revised posts are updated when published
+			if post.Updated.Equal(post.Date) {
+				post.Updated = post.FeedDate
+			}
+		}
+		i = j
+	}
+}
+
+// filter returns a copy of the index listing only the posts keep accepts
+func (index *Index) filter(keep func(*Post) bool) *Index {
+	filtered := *index
+	filtered.Posts = nil
+	for _, post := range index.Posts {
+		if keep(post) {
+			filtered.Posts = append(filtered.Posts, post)
+		}
+	}
+	return &filtered
+}
+
+// limit returns a copy of the index listing at most n non-draft posts
+func (index *Index) limit(n int) *Index {
+	return index.filter(func(post *Post) bool {
+		if post.Draft || n == 0 {
+			return false
+		}
+		n--
+		return true
+	})
+}
+
+// drafts returns a copy of the index listing only the draft posts, with
+// XMLURL pointing to the drafts feed
+func (index *Index) drafts() *Index {
+	drafts := index.filter(func(post *Post) bool { return post.Draft })
+	drafts.XMLURL = strings.TrimSuffix(index.URL, "/") + "/" + draftsFilename
+	return drafts
+}
+
+// duplicateTitles returns a message for each title shared by more than one
+// non-draft post, listing their files
+func duplicateTitles(posts []*Post) []string {
+	filenames := make(map[string][]string)
+	var titles []string
+	for _, post := range posts {
+		if post.Draft {
+			continue
+		}
+		if _, ok := filenames[post.Title]; !ok {
+			titles = append(titles, post.Title)
+		}
+		filenames[post.Title] = append(filenames[post.Title], post.filename)
+	}
+
+	var duplicates []string
+	for _, title := range titles {
+		if len(filenames[title]) > 1 {
+			sort.Strings(filenames[title])
+			duplicates = append(duplicates, fmt.Sprintf("duplicate title %q in %s", title, strings.Join(filenames[title], ", ")))
+		}
+	}
+	return duplicates
+}
+
+// writeLatest writes a page to outputPath that redirects to the newest post
+func writeLatest(outputPath string, index *Index) error {
+	post := index.Latest()
+	if post == nil {
+		return nil
+	}
+	link := html.EscapeString(post.Link)
+	page := fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>%s</title>
+  <link rel="canonical" href="%s">
+  <meta http-equiv="refresh" content="0; url=%s">
+</head>
+</html>
+`, html.EscapeString(post.Title), link, link)
+	return writeFileAtomic(path.Join(outputPath, latestFilename), func(w io.Writer) error {
+		_, err := io.WriteString(w, page)
+		return err
+	})
+}
+
+// writeRetries and writeBackoff are how often and after how long, doubling
+// each time, writeFileAtomic retries after transient errors
+var (
+	writeRetries = 3
+	writeBackoff = 50 * time.Millisecond
+)
+
+// writeFileAtomic writes to a temporary file next to filename and renames it
+// into place, so readers never see a partially written file. Transient
+// errors, e.g. on network filesystems, are retried, so write may be called
+// again.
+func writeFileAtomic(filename string, write func(io.Writer) error) error {
+	backoff := writeBackoff
+	for retry := 0; ; retry++ {
+		err := writeFileOnce(filename, write)
+		if err == nil || retry == writeRetries || !isTransient(err) {
+			return err
+		}
+		logger.Infof("retrying %s in %v: %v", filename, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// isTransient reports whether err may go away when retried, e.g. EAGAIN
+func isTransient(err error) bool {
+	var temporary interface{ Temporary() bool }
+	return errors.As(err, &temporary) && temporary.Temporary()
+}
+
+func writeFileOnce(filename string, write func(io.Writer) error) error {
+	f, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".")
+	if err != nil {
+		return err
+	}
+	// templates write in many small pieces
+	w := bufio.NewWriter(f)
+	if err := write(w); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
+
+// executeTemplateFile executes the named template atomically into filename
+func executeTemplateFile(tmpl templateSet, filename, name string, data interface{}) error {
+	return writeFileAtomic(filename, func(w io.Writer) error {
+		return tmpl.ExecuteTemplate(w, name, data)
+	})
+}
+
+var xmlDeclRe = regexp.MustCompile(`^<\?xml\s[^>]*?encoding=["']([^"']*)["']`)
+
+// executeFeedFile executes the named feed template atomically into filename.
+// Feeds are always UTF-8, the XML declaration is added if the template has
+// none.
+func executeFeedFile(tmpl templateSet, filename, name string, data interface{}) error {
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+		return err
+	}
+	feed := bytes.TrimLeft(buf.Bytes(), " \t\r\n")
+	if !utf8.Valid(feed) {
+		return fmt.Errorf("%s: feed is not valid UTF-8", name)
+	}
+	if m := xmlDeclRe.FindSubmatch(feed); m != nil {
+		if !strings.EqualFold(string(m[1]), "utf-8") {
+			return fmt.Errorf("%s: feed declares encoding %q, feeds are UTF-8", name, m[1])
+		}
+	} else if !bytes.HasPrefix(feed, []byte("<?xml")) {
+		feed = append([]byte(xml.Header), feed...)
+	}
+	return writeFileAtomic(filename, func(w io.Writer) error {
+		_, err := w.Write(feed)
+		return err
+	})
+}
+
+// fingerprintAssets copies each asset to a name containing the hash of its
+// content and returns the mapping from original to hashed names
+func fingerprintAssets(assetsPath, outputAssetsPath string, assets []string) (map[string]string, error) {
+	manifest := make(map[string]string, len(assets))
+	for _, name := range assets {
+		data, err := ioutil.ReadFile(filepath.Join(assetsPath, filepath.FromSlash(name)))
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(data)
+		ext := path.Ext(name)
+		hashed := strings.TrimSuffix(name, ext) + "." + hex.EncodeToString(sum[:])[:12] + ext
+		err = writeFileAtomic(filepath.Join(outputAssetsPath, filepath.FromSlash(hashed)), func(w io.Writer) error {
+			_, err := w.Write(data)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		manifest[name] = hashed
+	}
+	return manifest, nil
+}
+
+// writeManifest writes the asset manifest as JSON to filename
+func writeManifest(filename string, manifest map[string]string) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, func(w io.Writer) error {
+		_, err := w.Write(append(data, '\n'))
+		return err
+	})
+}
+
+// templateFuncs returns the functions available to templates. assetsURL is
+// the path the assets are served under and manifest maps asset names to their
+// fingerprinted names.
+func templateFuncs(assetsURL string, manifest map[string]string) template.FuncMap {
+	return template.FuncMap{
+		// asset returns the URL of the named asset, fingerprinted if enabled
+		"asset": func(name string) string {
+			if hashed, ok := manifest[name]; ok {
+				name = hashed
+			}
+			return path.Join(assetsURL, name)
+		},
+		// json encodes v as JSON, e.g. for JSON feeds
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}
+}
+
+// parseTemplates parses the named files into tmpl like template.ParseFiles,
+// but its errors name the offending file
+func parseTemplates(tmpl *template.Template, filenames ...string) (*template.Template, error) {
+	for _, filename := range filenames {
+		text, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		// the error of Parse already has the line, e.g. template: post.tmpl.html:3: ...
+		if _, err := tmpl.New(filepath.Base(filename)).Parse(string(text)); err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		logger.Debugf("parsed template %s", filename)
+	}
+	return tmpl, nil
+}
+
+// parseHTMLTemplates is parseTemplates for html/template
+func parseHTMLTemplates(tmpl *htmltemplate.Template, filenames ...string) (*htmltemplate.Template, error) {
+	for _, filename := range filenames {
+		text, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tmpl.New(filepath.Base(filename)).Parse(string(text)); err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		logger.Debugf("parsed template %s", filename)
+	}
+	return tmpl, nil
+}
+
+// templateSet is a set of parsed templates of either template package
+type templateSet interface {
+	ExecuteTemplate(w io.Writer, name string, data interface{}) error
+}
+
+// parseTheme parses the templates of the build. The HTML pages are parsed
+// with html/template, which escapes their data by context, and the feeds with
+// text/template since their data is escaped for XML already.
+func parseTheme(config *Config, assetsURL string, manifest map[string]string) (pages *htmltemplate.Template, feeds *template.Template, err error) {
+	funcs := templateFuncs(assetsURL, manifest)
+	var pageFilenames, feedFilenames []string
+	for _, filename := range templateFilenames(config) {
+		if strings.HasSuffix(filename, ".html") {
+			pageFilenames = append(pageFilenames, filename)
+		} else {
+			feedFilenames = append(feedFilenames, filename)
+		}
+	}
+	if pages, err = parseHTMLTemplates(htmltemplate.New("").Funcs(htmltemplate.FuncMap(funcs)), pageFilenames...); err != nil {
+		return nil, nil, err
+	}
+	if feeds, err = parseTemplates(template.New("").Funcs(funcs), feedFilenames...); err != nil {
+		return nil, nil, err
+	}
+
+	sets := []struct {
+		trees  map[string]*parse.Tree
+		define func(name string)
+	}{
+		{htmlTrees(pages), func(name string) { htmltemplate.Must(pages.New(name).Parse("")) }},
+		{textTrees(feeds), func(name string) { template.Must(feeds.New(name).Parse("")) }},
+	}
+	for _, set := range sets {
+		for _, name := range undefinedTemplates(set.trees) {
+			if !config.LenientTemplates {
+				return nil, nil, fmt.Errorf("template %q is referenced but not defined", name)
+			}
+			logger.Infof("warning: template %q is referenced but not defined, rendering nothing in its place", name)
+			set.define(name)
+		}
+	}
+	return pages, feeds, nil
+}
+
+// textTrees returns the parse trees of the templates of tmpl by name
+func textTrees(tmpl *template.Template) map[string]*parse.Tree {
+	trees := make(map[string]*parse.Tree)
+	for _, t := range tmpl.Templates() {
+		trees[t.Name()] = t.Tree
+	}
+	return trees
+}
+
+// htmlTrees returns the parse trees of the templates of tmpl by name
+func htmlTrees(tmpl *htmltemplate.Template) map[string]*parse.Tree {
+	trees := make(map[string]*parse.Tree)
+	for _, t := range tmpl.Templates() {
+		trees[t.Name()] = t.Tree
+	}
+	return trees
+}
 
-	frontmatter, err := parseFrontmatter(&body)
-	if err != nil {
-		return err
+// undefinedTemplates returns the sorted names of the templates referenced by
+// {{template}} actions in trees, the parse trees of a set by name, but not
+// defined in the set
+func undefinedTemplates(trees map[string]*parse.Tree) []string {
+	undefined := make(map[string]bool)
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch node := node.(type) {
+		case *parse.ListNode:
+			if node == nil {
+				return
+			}
+			for _, n := range node.Nodes {
+				walk(n)
+			}
+		case *parse.IfNode:
+			walk(node.List)
+			walk(node.ElseList)
+		case *parse.RangeNode:
+			walk(node.List)
+			walk(node.ElseList)
+		case *parse.WithNode:
+			walk(node.List)
+			walk(node.ElseList)
+		case *parse.TemplateNode:
+			if trees[node.Name] == nil {
+				undefined[node.Name] = true
+			}
+		}
 	}
+	for _, tree := range trees {
+		if tree != nil {
+			walk(tree.Root)
+		}
+	}
+	var names []string
+	for name := range undefined {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
 
-	if v, ok := frontmatter["title"]; ok {
-		title = v.(string)
-	} else {
-		return fmt.Errorf("could not read the title from post")
+// templateFilenames returns the paths of the templates the build uses
+func templateFilenames(config *Config) []string {
+	filenames := []string{
+		path.Join(config.TemplatesPath, postTmplFilename),
+		path.Join(config.TemplatesPath, indexTmplFilename),
+	}
+	for _, name := range config.Feeds {
+		if feed, ok := feedFormats[name]; ok && feed.Template != "" {
+			filenames = append(filenames, path.Join(config.TemplatesPath, feed.Template))
+		}
 	}
+	if config.Recent > 0 {
+		filenames = append(filenames, path.Join(config.TemplatesPath, recentTmplFilename))
+	}
+	// tag pages and the sitemap template are optional, they are used if the
+	// theme has the template
+	for _, name := range []string{tagTmplFilename, sitemapTmplFilename} {
+		filename := path.Join(config.TemplatesPath, name)
+		if _, err := os.Stat(filename); err == nil {
+			filenames = append(filenames, filename)
+		}
+	}
+	return filenames
+}
 
-	if v, ok := frontmatter["draft"]; ok {
-		draft = v.(bool)
+// postErrors are the errors of all the posts that failed to read
+type postErrors []error
+
+func (errs postErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
 	}
+	return strings.Join(msgs, "\n")
+}
 
-	if v, ok := frontmatter["date"]; ok {
-		if date, err = time.Parse(shortTimeFormat, v.(string)); err != nil {
+// readPosts reads the posts in files under sourcePath, skipping the settings
+// file. Posts are read concurrently but returned in the order of files. If any
+// fail, the errors of all of them are returned as postErrors.
+func readPosts(ctx context.Context, index *Index, sourcePath string, files []string) ([]*Post, error) {
+	posts := make([]*Post, len(files))
+	errs := parallel(ctx, index.settings().jobs(), len(files), func(i int) error {
+		if filepath.Base(files[i]) == settingsFilename {
+			return nil
+		}
+		start := time.Now()
+		post := &Post{Index: index, dir: sourceDir(sourcePath, files[i])}
+		if err := post.ReadFile(ctx, files[i]); err != nil {
 			return err
 		}
+		logger.Debugf("read %s in %v", files[i], time.Since(start))
+		posts[i] = post
+		return nil
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := collectErrors(errs); err != nil {
+		return nil, err
 	}
 
-	var descBuf, titleBuf bytes.Buffer
-	xml.EscapeText(&descBuf, bytes.Trim(body[:200], " \n\r"))
-	xml.EscapeText(&titleBuf, []byte(title))
+	read := make([]*Post, 0, len(files))
+	for _, post := range posts {
+		if post != nil {
+			read = append(read, post)
+		}
+	}
+	return read, nil
+}
 
-	p.Slug = strings.TrimSuffix(filepath.Base(filename), ".md")
-	p.OutputFilename = path.Join("post", p.Slug+".html")
-	p.Body = string(blackfriday.MarkdownOptions(body, renderer, blackfriday.Options{Extensions: commonExtensions}))
-	p.Title = title
-	p.Date = date
-	p.Link = strings.TrimSuffix(p.Index.URL, "/") + "/" + path.Join("post", p.Slug)
-	p.RelativeLink = path.Join("/", "post", p.Slug)
-	p.XMLDesc = descBuf.String()
-	p.XMLTitle = titleBuf.String()
-	p.Draft = draft
+// parallel calls f with each index below n, on up to workers goroutines at
+// once, and returns the errors by index. It stops starting calls once ctx is
+// done.
+func parallel(ctx context.Context, workers, n int, f func(i int) error) []error {
+	errs := make([]error, n)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				errs[i] = f(i)
+			}
+		}()
+	}
+send:
+	for i := 0; i < n; i++ {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return errs
+}
 
+// collectErrors returns the errors in errs as postErrors, or nil if there
+// are none
+func collectErrors(errs []error) error {
+	var failed postErrors
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	if len(failed) > 0 {
+		return failed
+	}
 	return nil
 }
 
-// Index represents global settings/variables and the index of the posts
-// the index.html will generated from Index
-type Index struct {
-	Title     string
-	Posts     []*Post
-	URL       string
-	XMLURL    string
-	UpdatedAt time.Time
+// skipDrafts returns posts without the drafts, removing any of their pages
+// left in outputPath by a build that included them
+func skipDrafts(outputPath string, posts []*Post) ([]*Post, error) {
+	published := posts[:0]
+	for _, post := range posts {
+		if !post.Draft {
+			published = append(published, post)
+			continue
+		}
+		if err := os.Remove(path.Join(outputPath, post.OutputFilename)); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return published, nil
 }
 
-func (index *Index) Len() int           { return len(index.Posts) }
-func (index *Index) Swap(i, j int)      { index.Posts[i], index.Posts[j] = index.Posts[j], index.Posts[i] }
-func (index *Index) Less(i, j int) bool { return index.Posts[i].Date.Before(index.Posts[j].Date) }
-
-// ReadFrontmatterFile will fill the index frontmatter from given filename
-func (index *Index) ReadFrontmatterFile(filename string) error {
-	body, err := ioutil.ReadFile(filename)
-	if err == nil {
-		return index.ReadFrontmatter(body)
+// sourceDir returns the directory of filename relative to sourcePath, empty
+// for the files directly in it
+func sourceDir(sourcePath, filename string) string {
+	dir, err := filepath.Rel(sourcePath, filepath.Dir(filename))
+	if err != nil || dir == "." || strings.HasPrefix(dir, "..") {
+		return ""
 	}
-	return err
+	return filepath.ToSlash(dir)
 }
 
-// ReadFrontmatter will fill the index frontmatter from given data
-func (index *Index) ReadFrontmatter(body []byte) error {
-	indexFrontmatter, err := parseFrontmatter(&body)
+// buildMu serializes builds, e.g. a watch rebuild and a running build
+var buildMu sync.Mutex
+
+// buildAll builds the whole blog and returns the generated paths relative to
+// the output path. It stops between files once ctx is done and returns the
+// context's error; files written until then are complete since every write is
+// atomic.
+func buildAll(ctx context.Context, config *Config) ([]string, error) {
+	buildMu.Lock()
+	defer buildMu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	outputPath := path.Join(config.OutputPath, config.Subdir)
+	feeds, err := config.feeds()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	indexFilename := path.Join(config.SourcePath, settingsFilename)
+	index := &Index{config: config}
+	if err := index.ReadFrontmatterFile(indexFilename); err != nil {
+		return nil, fmt.Errorf("error in reading frontmatter of %q: %v", settingsFilename, err)
+	}
+	manifest := make(map[string]string)
+	pages, feedTmpl, err := parseTheme(config, index.assetsURL(), manifest)
+	if err != nil {
+		return nil, err
 	}
 
-	index.Title = indexFrontmatter["title"].(string)
-	index.URL = indexFrontmatter["url"].(string)
-	index.XMLURL = indexFrontmatter["xmlurl"].(string)
-	index.UpdatedAt = time.Now()
-	return nil
-}
+	files, err := listSourceFiles(config.SourcePath, config.sourceExts())
+	if err != nil {
+		return nil, err
+	}
 
-func parseFrontmatter(body *[]byte) (map[string]interface{}, error) {
-	var frontmatterBuf bytes.Buffer
-	buf := bytes.NewBuffer(*body)
-	started := false
-	for {
-		line, err := buf.ReadString('\n')
+	// copy and walk the target of a symlinked assets directory, not the link
+	assetsPath, err := filepath.EvalSymlinks(config.AssetsPath)
+	if err != nil {
+		return nil, fmt.Errorf("error copying assets from %v to %v: %v", config.AssetsPath, outputPath, err)
+	}
+	if err := copyAssets(assetsPath, path.Join(outputPath, config.AssetsPrefix)); err != nil {
+		return nil, fmt.Errorf("error copying assets from %v to %v: %v", config.AssetsPath, outputPath, err)
+	}
+	assets, err := listFiles(assetsPath)
+	if err != nil {
+		return nil, err
+	}
+	generated := make([]string, 0, len(assets)+len(files)+8)
+	for _, filename := range assets {
+		generated = append(generated, path.Join(config.AssetsPrefix, filename))
+	}
+	if config.CodeStyle != "" {
+		filename := path.Join(config.AssetsPrefix, codeStyleFilename)
+		if err := writeCodeStyle(path.Join(outputPath, filename), config.CodeStyle); err != nil {
+			return nil, err
+		}
+		generated = append(generated, filename)
+	}
+	if config.Fingerprint {
+		hashedAssets, err := fingerprintAssets(assetsPath, path.Join(outputPath, config.AssetsPrefix), assets)
 		if err != nil {
 			return nil, err
 		}
-
-		if line == "---\n" {
-			if started {
-				break
-			}
-			started = true
+		for name, hashed := range hashedAssets {
+			manifest[name] = hashed
+			generated = append(generated, path.Join(config.AssetsPrefix, hashed))
 		}
-		if started {
-			frontmatterBuf.Write([]byte(line))
+		if err := writeManifest(path.Join(outputPath, manifestFilename), manifest); err != nil {
+			return nil, err
 		}
+		generated = append(generated, manifestFilename)
 	}
 
-	*body = buf.Bytes() // rest of the bytes
-	frontmatter := make(map[string]interface{})
-	return frontmatter, yaml.Unmarshal(frontmatterBuf.Bytes(), &frontmatter)
-}
+	if err := os.MkdirAll(path.Join(outputPath, config.PostsDir), 0755); err != nil {
+		return nil, err
+	}
 
-// listSourceFiles lists files that has ".md" extension in specified path
-func listSourceFiles(sourcePath string) (filenames []string, err error) {
-	filenames, err = filepath.Glob(path.Join(sourcePath, "*.md"))
-	return
-}
+	data, err := readData(config.DataPath)
+	if err != nil {
+		return nil, err
+	}
+	index.Site = Site{BuildTime: time.Now(), Commit: buildCommit(config.SourcePath), Data: data}
 
-// buildAll builds the whole blog
-func buildAll(templatesPath, outputPath string, sourcePath string, assetsPath string) {
-	log.SetFlags(log.LstdFlags)
-	tmpl := template.Must(template.ParseFiles(
-		path.Join(templatesPath, postTmplFilename),
-		path.Join(templatesPath, indexTmplFilename),
-		path.Join(templatesPath, feedTmplFilename),
-	))
+	if index.Posts, err = readPosts(ctx, index, config.SourcePath, files); err != nil {
+		return nil, err
+	}
+	if !config.Drafts && !config.Preview {
+		if index.Posts, err = skipDrafts(outputPath, index.Posts); err != nil {
+			return nil, err
+		}
+	}
+	index.Site.Menu = menu(index.Posts)
 
-	files, err := listSourceFiles(sourcePath)
-	if err != nil {
-		log.Fatal("ioutil.ReadFile:", err)
+	// newest first, a closure sorts faster than sort.Reverse's interface
+	posts := index.Posts
+	sort.SliceStable(posts, func(i, j int) bool { return posts[j].Date.Before(posts[i].Date) })
+	index.linkNeighbors()
+	if config.DistinctDates {
+		index.distinctFeedDates()
 	}
 
-	if err := copy.Copy(assetsPath, path.Join(outputPath, "assets")); err != nil {
-		log.Fatalf("error copying assets from %v to %v", assetsPath, outputPath)
+	// the posts link to each other, so they get their images before any is
+	// written
+	ogImages := make([]string, len(index.Posts))
+	if config.OGImages {
+		for i, post := range index.Posts {
+			if post.Image != "" {
+				continue
+			}
+			ogImages[i] = path.Join(ogImageDir, post.Slug+".png")
+			post.Image = strings.TrimSuffix(index.URL, "/") + "/" + ogImages[i]
+		}
 	}
 
-	indexFilename := path.Join(sourcePath, settingsFilename)
-	index := &Index{}
-	if err := index.ReadFrontmatterFile(indexFilename); err != nil {
-		log.Fatalf("error in reading frontmatter of %q: %v", settingsFilename, err)
+	// posts are written concurrently, each into its own files, and only read
+	// the posts while writing
+	postFiles := make([][]string, len(index.Posts))
+	errs := parallel(ctx, config.jobs(), len(index.Posts), func(i int) error {
+		if config.IndexOnly {
+			return nil
+		}
+		post := index.Posts[i]
+		if filename := ogImages[i]; filename != "" {
+			if err := writeOGImage(path.Join(outputPath, filename), post); err != nil {
+				return err
+			}
+			postFiles[i] = append(postFiles[i], filename)
+		}
+		start := time.Now()
+		if err := os.MkdirAll(path.Dir(path.Join(outputPath, post.OutputFilename)), 0755); err != nil {
+			return err
+		}
+		if err := executeTemplateFile(pages, path.Join(outputPath, post.OutputFilename), postTmplFilename, post); err != nil {
+			return err
+		}
+		logger.Debugf("wrote %s in %v", post.OutputFilename, time.Since(start))
+		postFiles[i] = append(postFiles[i], post.OutputFilename)
+		return nil
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := collectErrors(errs); err != nil {
+		return nil, err
+	}
+	for _, files := range postFiles {
+		generated = append(generated, files...)
+	}
+
+	// the feed only changes with its posts, unless told otherwise
+	if updated := index.lastUpdated(); !config.UpdatedNow && !updated.IsZero() {
+		index.UpdatedAt = updated
+	}
+
+	for _, duplicate := range duplicateTitles(index.Posts) {
+		if config.Strict {
+			return nil, fmt.Errorf("%s", duplicate)
+		}
+		logger.Info("warning:", duplicate)
+	}
+	for _, conflict := range tagConflicts(index.Posts) {
+		if config.Strict {
+			return nil, fmt.Errorf("%s", conflict)
+		}
+		logger.Info("warning:", conflict)
 	}
 
-	var outfile *os.File
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
-	for _, filename := range files {
-		// skip the settings file
-		if filepath.Base(filename) == settingsFilename {
-			continue
+	// index.html and page/*.html
+	if config.PerPage > 0 && config.HomepageLimit == 0 {
+		if err := os.MkdirAll(path.Join(outputPath, pageDir), 0755); err != nil {
+			return nil, err
+		}
+		for i, page := range index.paginate(config.PerPage) {
+			filename := pageFilename(i + 1)
+			if err := executeTemplateFile(pages, path.Join(outputPath, filename), indexTmplFilename, page); err != nil {
+				return nil, err
+			}
+			generated = append(generated, filename)
+		}
+	} else {
+		homepage := index
+		if config.HomepageLimit > 0 {
+			homepage = index.limit(config.HomepageLimit)
 		}
-		post := &Post{Index: index}
-		if err := post.ReadFile(filename); err != nil {
-			log.Fatalln("post.ReadFile:", err)
+		if err := executeTemplateFile(pages, path.Join(outputPath, "index.html"), indexTmplFilename, homepage); err != nil {
+			return nil, err
 		}
-		index.Posts = append(index.Posts, post)
+		generated = append(generated, "index.html")
+	}
 
-		if outfile, err = os.Create(path.Join(outputPath, post.OutputFilename)); err != nil {
-			log.Fatalln("os.Create:", err)
+	// archive.html
+	if config.HomepageLimit > 0 {
+		if err := executeTemplateFile(pages, path.Join(outputPath, archiveFilename), indexTmplFilename, index); err != nil {
+			return nil, err
 		}
-		if tmpl.ExecuteTemplate(outfile, postTmplFilename, post); err != nil {
-			log.Fatalln("tmpl.ExecuteTemplate:", err)
+		generated = append(generated, archiveFilename)
+	}
+
+	// tag/*.html
+	if pages.Lookup(tagTmplFilename) != nil {
+		tagPages, err := writeTagPages(pages, outputPath, index)
+		if err != nil {
+			return nil, err
 		}
+		generated = append(generated, tagPages...)
 	}
 
-	sort.Sort(sort.Reverse(index))
+	// index.xml and the other feeds
+	feedFiles, err := writeFeeds(feedTmpl, outputPath, feeds, index)
+	if err != nil {
+		return nil, err
+	}
+	generated = append(generated, feedFiles...)
 
-	// index.html
-	if outfile, err = os.Create(path.Join(outputPath, "index.html")); err != nil {
-		log.Fatalln("os.Create:", err)
+	// sitemap.xml
+	if feedTmpl.Lookup(sitemapTmplFilename) != nil {
+		if err := executeFeedFile(feedTmpl, path.Join(outputPath, sitemapFilename), sitemapTmplFilename, sitemap(index)); err != nil {
+			return nil, err
+		}
+	} else if err := writeFileAtomic(path.Join(outputPath, sitemapFilename), func(w io.Writer) error {
+		return writeSitemap(w, index)
+	}); err != nil {
+		return nil, err
 	}
-	if err := tmpl.ExecuteTemplate(outfile, indexTmplFilename, index); err != nil {
-		log.Fatalln("tmpl.ExecuteTemplate:", err)
+	generated = append(generated, sitemapFilename)
+
+	// drafts.xml, never part of a production build, is an RSS feed
+	draftsFeed := path.Join(outputPath, draftsFilename)
+	if config.Preview && feedTmpl.Lookup(feedTmplFilename) != nil {
+		if err := executeFeedFile(feedTmpl, draftsFeed, feedTmplFilename, index.drafts()); err != nil {
+			return nil, err
+		}
+		generated = append(generated, draftsFilename)
+	} else if err := os.Remove(draftsFeed); err != nil && !os.IsNotExist(err) {
+		return nil, err
 	}
 
-	// index.xml
-	if outfile, err = os.Create(path.Join(outputPath, "index.xml")); err != nil {
-		log.Fatalln("os.Create:", err)
+	// recent.html
+	if config.Recent > 0 {
+		if err := executeTemplateFile(pages, path.Join(outputPath, recentFilename), recentTmplFilename, index.limit(config.Recent)); err != nil {
+			return nil, err
+		}
+		generated = append(generated, recentFilename)
 	}
-	if err := tmpl.ExecuteTemplate(outfile, feedTmplFilename, index); err != nil {
-		log.Fatalln("tmpl.ExecuteTemplate:", err)
+
+	// latest.html
+	if config.Latest && index.Latest() != nil {
+		if err := writeLatest(outputPath, index); err != nil {
+			return nil, err
+		}
+		generated = append(generated, latestFilename)
 	}
+
+	sort.Strings(generated)
+	return generated, nil
 }
 
 type fileServer struct {
@@ -244,13 +2095,16 @@ type fileServer struct {
 }
 
 func (n *fileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	log.Println(r.Method, r.URL.String())
+	logger.Info(r.Method, r.URL.String())
 	if strings.HasSuffix(r.URL.Path, n.suffix) {
 		http.NotFound(w, r)
 		return
 	}
 	if n.defaultExt != "" {
-		if r.URL.Path != "/" && !strings.HasSuffix(r.URL.Path, n.defaultExt) {
+		// files of known types, e.g. index.xml, are served as they are, while
+		// dots in slugs don't make an extension
+		known := mime.TypeByExtension(path.Ext(r.URL.Path)) != ""
+		if !strings.HasSuffix(r.URL.Path, "/") && !strings.HasSuffix(r.URL.Path, n.defaultExt) && !known {
 			r.URL.Path = r.URL.Path + n.defaultExt
 		}
 	}
@@ -262,44 +2116,282 @@ func FileServer(suffix string, defaultExt string, h http.Handler) http.Handler {
 	return &fileServer{suffix: suffix, defaultExt: defaultExt, h: h}
 }
 
+// serveMux returns the handler serving the built blog. Assets are served from
+// assetsDir unless it is empty. Pages aren't cached when previewing.
+func serveMux(config *Config, assetsDir string) http.Handler {
+	compress := func(h http.Handler) http.Handler {
+		if config.Gzip {
+			return CompressHandler(h)
+		}
+		return h
+	}
+	mux := http.NewServeMux()
+	if assetsDir != "" {
+		fs := FileServer("/", "", GzipHandler(assetsDir, http.FileServer(http.Dir(assetsDir))))
+		if config.AssetListing {
+			fs = ListingHandler(assetsDir, fs)
+		}
+		prefix := config.assetsURL()
+		mux.Handle(prefix+"/", http.StripPrefix(prefix, compress(fs)))
+	}
+
+	fs := FileServer("/"+config.PostsDir+"/", ".html", GzipHandler(config.OutputPath, http.FileServer(http.Dir(config.OutputPath))))
+	mux.Handle("/", compress(fs))
+	return HeadersHandler(config.Preview, mux)
+}
+
+// BasePathHandler serves h under basePath, e.g. "/blog", the way the site is
+// linked when hosted under a prefix. Other paths are not found.
+func BasePathHandler(basePath string, h http.Handler) http.Handler {
+	if basePath == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == basePath {
+			http.Redirect(w, r, basePath+"/", http.StatusMovedPermanently)
+			return
+		}
+		http.StripPrefix(basePath, h).ServeHTTP(w, r)
+	})
+}
+
+// shutdownTimeout is how long the server waits for the requests in flight
+// when shutting down
+const shutdownTimeout = 5 * time.Second
+
+// serve serves handler on addr until ctx is done, then shuts the server down
+// gracefully. The error is nil after a clean shutdown.
+func serve(ctx context.Context, addr string, handler http.Handler) error {
+	server := &http.Server{Addr: addr, Handler: handler}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return server.Shutdown(shutdownCtx)
+}
+
+// maintenanceRetryAfter is how long clients are told to wait in maintenance mode
+const maintenanceRetryAfter = time.Hour
+
+type maintenanceHandler struct {
+	page       []byte
+	retryAfter time.Duration
+}
+
+func (m *maintenanceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	logger.Info(r.Method, r.URL.String())
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Retry-After", strconv.Itoa(int(m.retryAfter.Seconds())))
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write(m.page)
+}
+
+// MaintenanceHandler will respond to every request with page and a 503 status
+func MaintenanceHandler(page []byte, retryAfter time.Duration) http.Handler {
+	return &maintenanceHandler{page: page, retryAfter: retryAfter}
+}
+
+// branchSubdir returns the output subdirectory of a preview of the current
+// branch, named by $BLGO_BRANCH or else by git
+func branchSubdir() (string, error) {
+	branch := os.Getenv("BLGO_BRANCH")
+	if branch == "" {
+		out, err := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD").Output()
+		if err != nil {
+			return "", fmt.Errorf("git rev-parse: %v", err)
+		}
+		branch = strings.TrimSpace(string(out))
+	}
+	subdir := strings.Trim(unsafePathRe.ReplaceAllString(branch, "-"), "-")
+	if subdir == "" {
+		return "", fmt.Errorf("invalid branch name %q", branch)
+	}
+	return subdir, nil
+}
+
+var unsafePathRe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// buildCommit returns the commit of the source in dir, named by $BLGO_COMMIT
+// or else by git. It is empty if dir is not in a git repository.
+func buildCommit(dir string) string {
+	if commit := os.Getenv("BLGO_COMMIT"); commit != "" {
+		return commit
+	}
+	cmd := exec.Command("git", "rev-parse", "--short", "HEAD")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// isIndexTemplate reports whether filename is a template that no post page
+// depends on. The settings file is not one, post pages may show e.g. the title.
+func isIndexTemplate(config *Config, filename string) bool {
+	for _, name := range []string{indexTmplFilename, recentTmplFilename, tagTmplFilename, sitemapTmplFilename} {
+		if filepath.Clean(filename) == filepath.Join(config.TemplatesPath, name) {
+			return true
+		}
+	}
+	for _, feed := range feedFormats {
+		if feed.Template != "" && filepath.Clean(filename) == filepath.Join(config.TemplatesPath, feed.Template) {
+			return true
+		}
+	}
+	return false
+}
+
+// stringsFlag is a flag.Value for a comma-separated list of strings
+type stringsFlag []string
+
+func (s *stringsFlag) String() string { return strings.Join(*s, ",") }
+
+func (s *stringsFlag) Set(value string) error {
+	*s = nil
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*s = append(*s, v)
+		}
+	}
+	return nil
+}
+
 func main() {
-	log.SetFlags(log.Lshortfile)
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:], os.Stdin, os.Stdout); err != nil {
+				logger.Fatal(err)
+			}
+			return
+		}
+	}
+
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s [options] sources\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s render [options] filename|-\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s export [-since date] sources\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s list [-json] sources\n", os.Args[0])
 		flag.PrintDefaults()
 	}
 
+	jobsFlag := flag.Int("jobs", 0, "number of posts to read and write at once, 0 for GOMAXPROCS")
+	cleanFlag := flag.Bool("clean", false, "remove the contents of the output directory before building")
+	cleanDryRunFlag := flag.Bool("clean-dry-run", false, "list what -clean would remove, without removing or building anything")
 	watchFlag := flag.Bool("watch", false, "tries to rebuild the src on change")
+	liveReloadFlag := flag.Bool("livereload", true, "when serving in watch mode, reload the open pages after each rebuild")
+	debounceFlag := flag.Duration("debounce", 200*time.Millisecond, "in watch mode, wait this long after the last change before rebuilding")
 	serveFlag := flag.String("serve", "", "listening address for serving the blog")
 	outPathFlag := flag.String("output", "generated", "output path")
 	assetsFlag := flag.String("assets", "", "path to the assets files for serving")
+	dataFlag := flag.String("data", "data", "path to the YAML and JSON data files, available in templates as .Site.Data by filename")
 	templatesFlag := flag.String("templates", "", "path to the templates directory")
+	canonicalHostFlag := flag.String("canonical-host", "", "in serve mode, redirect requests for other hosts to this host, or to a URL like https://example.com to also redirect to its scheme")
+	maintenanceFlag := flag.String("maintenance", "", "path to a page served with 503 for every request")
+	latestFlag := flag.Bool("latest", false, "generate /latest redirecting to the newest post")
+	recentFlag := flag.Int("recent", 0, "number of newest posts listed in recent.html, rendered with "+recentTmplFilename+"; 0 disables it")
+	perPageFlag := flag.Int("perpage", 10, "number of posts per page of the index, the rest are in "+pageDir+"/2.html and so on, 0 for a single page")
+	homepageLimitFlag := flag.Int("homepage-limit", 0, "maximum number of posts in index.html, all posts are listed in "+archiveFilename)
+	guidFlag := flag.String("guid", defaultConfig().GUID, "scheme of the feed item GUIDs: link, taguri or hash")
+	branchSubdirFlag := flag.Bool("branch-subdir", false, "nest the output and URLs under a directory named after $BLGO_BRANCH or the current git branch")
+	stripTitleHeadingFlag := flag.Bool("strip-title-heading", defaultConfig().StripTitleHeading, "remove the H1 used as the title of posts without a frontmatter title from their body")
+	allowHTMLFlag := flag.Bool("allow-html", defaultConfig().AllowHTML, "render raw HTML in posts as is, otherwise sanitize it with an allowlist")
+	lenientTemplatesFlag := flag.Bool("lenient-templates", false, "warn about templates referencing undefined templates instead of failing")
+	updatedNowFlag := flag.Bool("updated-now", false, "use the build time as the feed's update time instead of the newest post's date")
+	cpuprofileFlag := flag.String("cpuprofile", "", "write a CPU profile of the build to this file")
+	memprofileFlag := flag.String("memprofile", "", "write a memory profile after the build to this file")
+	quietFlag := flag.Bool("quiet", false, "only log errors and the summary of the build")
+	verboseFlag := flag.Bool("verbose", false, "also log the time each post took and the templates parsed")
+	feedBodyLimitFlag := flag.Int("feed-body-limit", 0, "maximum bytes of the post body in full-content feeds, longer posts are cut with a link to the rest; 0 means no limit")
+	draftsFlag := flag.Bool("drafts", false, "include draft posts, which are skipped by default outside watch mode")
+	indexOnlyFlag := flag.Bool("index-only", false, "only build the index pages and feeds, not the posts")
+	lenientFlag := flag.Bool("lenient", false, "build markdown files without frontmatter, titled by their filename and dated by their modification time")
+	assetListingFlag := flag.Bool("asset-listing", false, "list the files of asset directories in serve mode")
+	gzipFlag := flag.Bool("gzip", defaultConfig().Gzip, "in serve mode, compress the responses for clients accepting gzip")
+	distinctDatesFlag := flag.Bool("distinct-dates", false, "space the feed dates of posts with the same date a minute apart in the order they are listed")
+	codeStyleFlag := flag.String("codestyle", "", "highlight code blocks and write "+codeStyleFilename+" to the assets in this style, e.g. github")
+	lazyImagesFlag := flag.Bool("lazy-images", false, "load the images of posts lazily, sized by their asset files")
+	headingPermalinksFlag := flag.Bool("heading-permalinks", false, "give the headings of posts IDs and links to themselves")
+	strictFlag := flag.Bool("strict", false, "treat warnings, e.g. about duplicate titles, as errors")
+	postsDirFlag := flag.String("posts-dir", defaultConfig().PostsDir, "directory of the posts in the output and their URLs")
+	ogImagesFlag := flag.Bool("og-images", false, "generate an Open Graph image for posts without an image")
+	fingerprintFlag := flag.Bool("fingerprint", false, "copy assets under content-hashed names listed in "+manifestFilename)
+	shortcodesFlag := flag.String("unknown-shortcodes", defaultConfig().Shortcodes, "what to do with unknown shortcodes in posts: keep or error")
+	rendererCmdFlag := flag.String("renderer-cmd", "", "command rendering posts instead of the markdown renderer, reading a body on stdin and writing HTML to stdout")
+	rendererExtsFlag := stringsFlag(defaultConfig().RendererExts)
+	flag.Var(&rendererExtsFlag, "renderer-exts", "comma-separated extensions of the posts rendered by -renderer-cmd")
+	assetsPrefixFlag := flag.String("assets-prefix", defaultConfig().AssetsPrefix, "directory of the assets in the output and in their URLs")
+	feedsFlag := stringsFlag(defaultConfig().Feeds)
+	flag.Var(&feedsFlag, "feeds", "comma-separated feeds to generate: rss, atom, json, podcast")
+	excerptFlag := stringsFlag(defaultConfig().Excerpt)
+	flag.Var(&excerptFlag, "excerpt", "comma-separated excerpt sources in order of precedence: frontmatter, more, paragraph")
+	configFlag := flag.String("config", configFilename, "YAML file of flag values by flag name and the sources path as source, overridden by the command line")
 
 	flag.Parse()
 
-	if len(os.Args) <= 1 {
+	configGiven := false
+	flag.Visit(func(f *flag.Flag) { configGiven = configGiven || f.Name == "config" })
+	source, err := applyConfigFile(flag.CommandLine, *configFlag, configGiven)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if flag.NArg() > 0 {
+		source = flag.Arg(0)
+	}
+
+	if len(os.Args) <= 1 && source == "" {
 		flag.Usage()
 		os.Exit(1)
 	}
 
+	switch {
+	case *quietFlag && *verboseFlag:
+		logger.Fatal("-quiet and -verbose can't be used together")
+	case *quietFlag:
+		logger.Level = logQuiet
+	case *verboseFlag:
+		logger.Level = logVerbose
+	}
 	cwd, _ := os.Getwd()
 
 	// check output path
 	if stat, err := os.Stat(path.Join(cwd, *outPathFlag)); err != nil && !os.IsExist(err) || !stat.IsDir() {
 		err := os.Mkdir(*outPathFlag, 0755)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "specified path \"%s\" for output couldn't be created: %s\n", *outPathFlag, err)
-			os.Exit(1)
+			logger.Fatalf("specified path \"%s\" for output couldn't be created: %s", *outPathFlag, err)
 		}
 	}
 
+	// keep other blgo processes out of the output path until exit
+	release, err := acquireLock(*outPathFlag)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer release()
+	// a signal stops the builds and the server, then main returns
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		// another signal kills the process as usual
+		signal.Stop(signals)
+		cancel()
+	}()
+
 	// check post in output path
-	postPath := path.Join(cwd, *outPathFlag, "post")
+	postPath := path.Join(cwd, *outPathFlag, *postsDirFlag)
 	if stat, err := os.Stat(postPath); err != nil && !os.IsExist(err) || !stat.IsDir() {
 		err := os.Mkdir(postPath, 0755)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "path \"%s\" couldn't be created: %s\n", postPath, err)
-			os.Exit(1)
+			logger.Fatalf("path \"%s\" couldn't be created: %s", postPath, err)
 		}
 	}
 
@@ -308,69 +2400,214 @@ func main() {
 	if stat, err := os.Stat(assetsPath); err != nil && !os.IsExist(err) || !stat.IsDir() {
 		err := os.Mkdir(assetsPath, 0755)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "specified path \"%s\" for assets doesn't exists or is not a directory\n", *assetsFlag)
-			os.Exit(1)
+			logger.Fatalf("specified path \"%s\" for assets doesn't exists or is not a directory", *assetsFlag)
+		}
+	}
+
+	config := &Config{
+		TemplatesPath:     *templatesFlag,
+		OutputPath:        *outPathFlag,
+		SourcePath:        source,
+		AssetsPath:        assetsPath,
+		DataPath:          *dataFlag,
+		Latest:            *latestFlag,
+		Preview:           *watchFlag,
+		Drafts:            *draftsFlag,
+		Fingerprint:       *fingerprintFlag,
+		HomepageLimit:     *homepageLimitFlag,
+		PerPage:           *perPageFlag,
+		Recent:            *recentFlag,
+		OGImages:          *ogImagesFlag,
+		Excerpt:           excerptFlag,
+		Feeds:             feedsFlag,
+		PostsDir:          *postsDirFlag,
+		Strict:            *strictFlag,
+		GUID:              *guidFlag,
+		IndexOnly:         *indexOnlyFlag,
+		Shortcodes:        *shortcodesFlag,
+		StripTitleHeading: *stripTitleHeadingFlag,
+		AllowHTML:         *allowHTMLFlag,
+		LenientTemplates:  *lenientTemplatesFlag,
+		UpdatedNow:        *updatedNowFlag,
+		FeedBodyLimit:     *feedBodyLimitFlag,
+		Lenient:           *lenientFlag,
+		AssetListing:      *assetListingFlag,
+		Gzip:              *gzipFlag,
+		RendererCmd:       *rendererCmdFlag,
+		RendererExts:      rendererExtsFlag,
+		AssetsPrefix:      *assetsPrefixFlag,
+		DistinctDates:     *distinctDatesFlag,
+		HeadingPermalinks: *headingPermalinksFlag,
+		LazyImages:        *lazyImagesFlag,
+		CodeStyle:         *codeStyleFlag,
+		Jobs:              *jobsFlag,
+	}
+	if *branchSubdirFlag {
+		subdir, err := branchSubdir()
+		if err != nil {
+			logger.Fatal(err)
+		}
+		config.Subdir = subdir
+	}
+	if *cleanFlag || *cleanDryRunFlag {
+		if err := cleanOutput(config, *cleanDryRunFlag); err != nil {
+			logger.Fatal(err)
 		}
+		if *cleanDryRunFlag {
+			return
+		}
+	}
+	start := time.Now()
+	generated, err := profileBuild(ctx, config, *cpuprofileFlag, *memprofileFlag)
+	if err == context.Canceled {
+		return
+	} else if err != nil {
+		logger.Fatal(err)
 	}
+	logger.Printf("generated %d files in %v", len(generated), time.Since(start).Round(time.Millisecond))
 
-	sourcePath := flag.Arg(0)
-	buildAll(*templatesFlag, *outPathFlag, sourcePath, assetsPath)
+	var reload *liveReload
+	if *watchFlag && serveFlag != nil && *serveFlag != "" && *liveReloadFlag {
+		reload = newLiveReload()
+	}
 
+	// watching is closed when the watch loop returns, after its last build
+	var watching chan struct{}
 	if *watchFlag {
 		watcher, err := fsnotify.NewWatcher()
 		if err != nil {
-			log.Fatal(err)
+			logger.Fatal(err)
 		}
 		defer watcher.Close()
 
-		files, err := listSourceFiles(sourcePath)
+		files, err := listSourceFiles(config.SourcePath, config.sourceExts())
 		if err != nil {
-			log.Fatal("ioutil.ReadFile:", err)
+			logger.Fatal("ioutil.ReadFile:", err)
 		}
 		for _, filename := range files {
-			log.Println("adding", filename)
+			logger.Info("adding", filename)
 			if err := watcher.Add(filename); err != nil {
-				log.Fatal(err)
+				logger.Fatal(err)
 			}
 		}
-		for _, filename := range []string{indexTmplFilename, feedTmplFilename, postTmplFilename} {
-			if err := watcher.Add(path.Join(*templatesFlag, filename)); err != nil {
-				log.Fatal(err)
+		for _, filename := range templateFilenames(config) {
+			if err := watcher.Add(filename); err != nil {
+				logger.Fatal(err)
 			}
 		}
+		// the directories report the files created after startup
+		if err := watchDirs(watcher, config.SourcePath); err != nil {
+			logger.Fatal(err)
+		}
+		if err := watcher.Add(config.TemplatesPath); err != nil {
+			logger.Fatal(err)
+		}
 
+		watching = make(chan struct{})
 		go func() {
+			defer close(watching)
+			// editors save in several events, build once they settle
+			var settled <-chan time.Time
+			indexOnly := true
 			for {
 				select {
 				case event := <-watcher.Events:
-					log.Println(event)
-					if event.Op&fsnotify.Remove == fsnotify.Remove || event.Op&fsnotify.Write == fsnotify.Write {
-						buildAll(*templatesFlag, *outPathFlag, sourcePath, assetsPath)
-						watcher.Add(event.Name)
+					logger.Info(event)
+					isTemplate := filepath.Dir(event.Name) == filepath.Clean(config.TemplatesPath)
+					if event.Op&fsnotify.Create == fsnotify.Create {
+						if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+							if err := watchDirs(watcher, event.Name); err != nil {
+								logger.Error(err)
+							}
+							// a directory moved into the source brings its posts
+							indexOnly = false
+							settled = time.After(*debounceFlag)
+							continue
+						}
+						if !hasSourceExt(config, event.Name) && !isTemplate {
+							continue
+						}
+						logger.Info("adding", event.Name)
+						if err := watcher.Add(event.Name); err != nil {
+							logger.Error(err)
+						}
+						indexOnly = indexOnly && isTemplate && isIndexTemplate(config, event.Name)
+						settled = time.After(*debounceFlag)
+						continue
+					}
+					// the directories also report their other files, e.g. editor backups
+					if !hasSourceExt(config, event.Name) && !isTemplate {
+						continue
+					}
+					if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+						// the file is gone, its directory reports it if it comes back
+						watcher.Remove(event.Name)
+						indexOnly = indexOnly && isIndexTemplate(config, event.Name)
+						settled = time.After(*debounceFlag)
+					}
+					if event.Op&fsnotify.Write == fsnotify.Write {
+						indexOnly = indexOnly && isIndexTemplate(config, event.Name)
+						settled = time.After(*debounceFlag)
+					}
+				case <-settled:
+					rebuild := config
+					if indexOnly {
+						indexOnlyConfig := *config
+						indexOnlyConfig.IndexOnly = true
+						rebuild = &indexOnlyConfig
+					}
+					settled, indexOnly = nil, true
+					if _, err := buildAll(ctx, rebuild); err == context.Canceled {
+						return
+					} else if err != nil {
+						logger.Error(err)
+					} else if reload != nil {
+						reload.Reload()
 					}
 				case err := <-watcher.Errors:
-					log.Println(err)
+					logger.Error(err)
+				case <-ctx.Done():
+					return
 				}
 			}
 		}()
 	}
 
 	if serveFlag != nil && *serveFlag != "" {
+		var assetsDir string
 		if assetsFlag != nil && *assetsFlag != "" {
-			fs := FileServer("/", "", http.FileServer(http.Dir(*assetsFlag)))
-			http.Handle("/assets/", http.StripPrefix("/assets", fs))
+			assetsDir = config.outputAssetsPath()
 		}
 
-		fs := FileServer("/post/", ".html", http.FileServer(http.Dir(*outPathFlag)))
-		http.Handle("/", fs)
+		index := &Index{config: config}
+		if err := index.ReadFrontmatterFile(path.Join(config.SourcePath, settingsFilename)); err != nil {
+			logger.Fatal(err)
+		}
+		var handler http.Handler = BasePathHandler(index.basePath, serveMux(config, assetsDir))
+		if reload != nil {
+			handler = reload.Handler(handler)
+		}
+		if *maintenanceFlag != "" {
+			page, err := ioutil.ReadFile(*maintenanceFlag)
+			if err != nil {
+				logger.Fatal(err)
+			}
+			handler = MaintenanceHandler(page, maintenanceRetryAfter)
+		}
+		if *canonicalHostFlag != "" {
+			if handler, err = CanonicalHostHandler(*canonicalHostFlag, handler); err != nil {
+				logger.Fatal(err)
+			}
+		}
 
-		fmt.Fprintf(os.Stderr, "Listening on http://%s\n", *serveFlag)
-		if err := http.ListenAndServe(*serveFlag, nil); err != nil {
-			panic(err)
+		if logger.Level >= logNormal {
+			fmt.Fprintf(os.Stderr, "Listening on http://%s\n", *serveFlag)
 		}
-	} else if *watchFlag {
-		// blocking for watch
-		done := make(chan bool)
-		<-done
+		if err := serve(ctx, *serveFlag, handler); err != nil {
+			logger.Fatal(err)
+		}
+	}
+	if watching != nil {
+		<-watching
 	}
 }
@@ -1,10 +1,78 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"sort"
 	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"text/template"
+	"time"
+	"unicode/utf8"
 )
 
+var testTemplates = map[string]string{
+	postTmplFilename:  "{{.Title}}\n{{.Body}}",
+	indexTmplFilename: "{{range .Posts}}{{.Title}}\n{{end}}",
+	feedTmplFilename:  "<rss>{{range .Posts}}<item><link>{{.Link}}</link></item>{{end}}</rss>",
+	"atom.tmpl.xml":   "<feed>{{range .Posts}}<entry><id>{{.GUID}}</id></entry>{{end}}</feed>",
+}
+
+const testSettings = "---\ntitle: Test\nurl: https://example.com/\nxmlurl: https://example.com/index.xml\n---\n"
+
+// newTestSite writes templates and the given sources into dir and returns a
+// config that builds them into dir/output
+func newTestSite(t testing.TB, dir string, sources map[string]string) *Config {
+	config := defaultConfig()
+	config.TemplatesPath = path.Join(dir, "templates")
+	config.SourcePath = path.Join(dir, "src")
+	config.AssetsPath = path.Join(dir, "assets")
+	config.OutputPath = path.Join(dir, "output")
+
+	files := map[string]string{path.Join(config.SourcePath, settingsFilename): testSettings}
+	for name, text := range testTemplates {
+		files[path.Join(config.TemplatesPath, name)] = text
+	}
+	for name, text := range sources {
+		files[path.Join(config.SourcePath, name)] = text
+	}
+	for _, p := range []string{config.AssetsPath, path.Join(config.OutputPath, "post")} {
+		if err := os.MkdirAll(p, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for filename, text := range files {
+		if err := os.MkdirAll(path.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return config
+}
+
+// errorString returns the message of err, or "" if err is nil
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
 func TestParseFrontmatter(t *testing.T) {
 	for text, want := range map[string]map[string]string{
 		"---\ndate: 2000-10-20\ntitle: my post title\n---\n": map[string]string{
@@ -12,7 +80,7 @@ func TestParseFrontmatter(t *testing.T) {
 			"date":   "2000-10-20",
 			"_after": "",
 		},
-		"before\n---\ndate: 2001-10-20\ntitle: random title\n---\nafter frontmatter\nend": map[string]string{
+		"\n\n---\ndate: 2001-10-20\ntitle: random title\n---\nafter frontmatter\nend": map[string]string{
 			"title":  "random title",
 			"date":   "2001-10-20",
 			"_after": "after frontmatter\nend",
@@ -35,4 +103,1837 @@ func TestParseFrontmatter(t *testing.T) {
 			t.Errorf("got %q; want %q", string(body), want["_after"])
 		}
 	}
+
+	// a --- after text is a horizontal rule, not frontmatter
+	body := []byte("before\n---\ndate: 2001-10-20\n---\nafter\n")
+	if _, err := parseFrontmatter(&body); err != errNoFrontmatter {
+		t.Errorf("got %v; want %v", err, errNoFrontmatter)
+	}
+}
+
+func TestIndexReadFrontmatterRequired(t *testing.T) {
+	for text, want := range map[string]string{
+		"---\nurl: https://example.com/\nxmlurl: https://example.com/index.xml\n---\n":                "missing title",
+		"---\ntitle: t\nxmlurl: https://example.com/index.xml\n---\n":                                 "missing url",
+		"---\ntitle: t\nurl: https://example.com/\n---\n":                                             "missing xmlurl",
+		"---\ntitle: [a, b]\nurl: https://example.com/\nxmlurl: https://example.com/index.xml\n---\n": "invalid title: expected a string",
+	} {
+		if err := (&Index{}).ReadFrontmatter([]byte(text)); err == nil || !strings.HasPrefix(err.Error(), want) {
+			t.Errorf("for %q got %v; want an error starting with %q", text, err, want)
+		}
+	}
+}
+
+func TestIndexReadFrontmatterURLs(t *testing.T) {
+	for text, wantErr := range map[string]bool{
+		"---\ntitle: t\nurl: https://example.com/\nxmlurl: https://example.com/index.xml\n---\n":    false,
+		"---\ntitle: t\nurl: http://localhost:4040\nxmlurl: http://localhost:4040/index.xml\n---\n": false,
+		"---\ntitle: t\nurl: example.com\nxmlurl: https://example.com/index.xml\n---\n":             true,
+		"---\ntitle: t\nurl: https://example.com/\nxmlurl: /index.xml\n---\n":                       true,
+		"---\ntitle: t\nurl: https:///index.html\nxmlurl: https://example.com/index.xml\n---\n":     true,
+		"---\ntitle: t\nurl: ftp://example.com/\nxmlurl: https://example.com/index.xml\n---\n":      true,
+		"---\ntitle: t\nurl: https://example.com/\nxmlurl: \"https://exa mple.com/%zz\"\n---\n":     true,
+	} {
+		index := &Index{}
+		err := index.ReadFrontmatter([]byte(text))
+		if gotErr := err != nil; gotErr != wantErr {
+			t.Errorf("for %q got error %v; want error %v", text, err, wantErr)
+		}
+	}
+}
+
+func TestWriteLatest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	day := func(d int) time.Time { return time.Date(2017, 1, d, 0, 0, 0, 0, time.UTC) }
+	index := &Index{Posts: []*Post{
+		{Link: "https://example.com/post/old", Date: day(1)},
+		{Link: "https://example.com/post/new", Date: day(3)},
+		{Link: "https://example.com/post/draft", Date: day(5), Draft: true},
+		{Link: "https://example.com/post/middle", Date: day(2)},
+	}}
+	sort.Sort(sort.Reverse(index))
+
+	if err := writeLatest(dir, index); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(path.Join(dir, latestFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<meta http-equiv="refresh" content="0; url=https://example.com/post/new">`
+	if !strings.Contains(string(got), want) {
+		t.Errorf("got %q; want it to contain %q", got, want)
+	}
+}
+
+func TestReadExcerpt(t *testing.T) {
+	withDescription := "---\ntitle: t\ndescription: From frontmatter\n---\nFirst paragraph\nof the post.\n\nSecond paragraph.\n\n<!--more-->\n\nRest of the post.\n"
+	withoutDescription := "---\ntitle: t\n---\nFirst paragraph.\n\nSecond paragraph.\n\n<!--more-->\n\nRest of the post.\n"
+	withoutMarker := "---\ntitle: t\n---\n# Heading\n\nOnly paragraph.\n"
+	withList := "---\ntitle: t\n---\n\n- one\n- two\n\nAfter the list.\n"
+
+	for _, tt := range []struct {
+		sources []string
+		text    string
+		want    string
+	}{
+		{[]string{"frontmatter", "more", "paragraph"}, withDescription, "From frontmatter"},
+		{[]string{"more", "frontmatter", "paragraph"}, withDescription, "First paragraph of the post. Second paragraph."},
+		{[]string{"paragraph", "more", "frontmatter"}, withDescription, "First paragraph of the post."},
+		{[]string{"frontmatter", "more", "paragraph"}, withoutDescription, "First paragraph. Second paragraph."},
+		{[]string{"frontmatter", "more", "paragraph"}, withoutMarker, "Heading"},
+		{[]string{"paragraph"}, withList, "one two"},
+	} {
+		config := defaultConfig()
+		config.Excerpt = tt.sources
+		p := &Post{Index: &Index{config: config}}
+		if err := p.Read(context.Background(), "post.md", []byte(tt.text)); err != nil {
+			t.Fatal(err)
+		}
+		if p.Excerpt != tt.want {
+			t.Errorf("for sources %v got %q; want %q", tt.sources, p.Excerpt, tt.want)
+		}
+	}
+
+	config := defaultConfig()
+	config.Excerpt = []string{"unknown"}
+	p := &Post{Index: &Index{config: config}}
+	if err := p.Read(context.Background(), "post.md", []byte(withDescription)); err == nil {
+		t.Error("got nil error for unknown excerpt source")
+	} else if !strings.HasPrefix(err.Error(), "post.md: ") {
+		t.Errorf("got error %q; want it to name the file", err)
+	}
+}
+
+func TestBuildAllSerializes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"first.md":  "---\ntitle: First\ndate: 2017-01-01\n---\nHello.\n",
+		"second.md": "---\ntitle: Second\ndate: 2017-01-02\n---\nWorld.\n",
+	})
+
+	buildMu.Lock()
+	done := make(chan struct{})
+	go func() {
+		if _, err := buildAll(context.Background(), config); err != nil {
+			t.Error(err)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("buildAll ran while another build was in progress")
+	case <-time.After(50 * time.Millisecond):
+	}
+	buildMu.Unlock()
+	<-done
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := buildAll(context.Background(), config); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	got, err := ioutil.ReadFile(path.Join(config.OutputPath, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Second\nFirst\n"; string(got) != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+
+	for _, dir := range []string{config.OutputPath, path.Join(config.OutputPath, "post")} {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range files {
+			if strings.HasPrefix(f.Name(), ".") {
+				t.Errorf("temporary file %q left behind in %q", f.Name(), dir)
+			}
+		}
+	}
+}
+
+func TestReadMoreAnchor(t *testing.T) {
+	p := &Post{Index: &Index{}}
+	if err := p.Read(context.Background(), "split.md", []byte("---\ntitle: t\n---\nTeaser.\n\n<!--more-->\n\nRest.\n")); err != nil {
+		t.Fatal(err)
+	}
+	anchor := `<span id="more"></span>`
+	i := strings.Index(string(p.Body), anchor)
+	if i < 0 || !strings.Contains(string(p.Body)[:i], "Teaser.") || !strings.Contains(string(p.Body)[i:], "Rest.") {
+		t.Errorf("got body %q; want %q between the excerpt and the rest", p.Body, anchor)
+	}
+	if want := "/post/split#more"; p.ReadMoreLink != want {
+		t.Errorf("got %q; want %q", p.ReadMoreLink, want)
+	}
+
+	p = &Post{Index: &Index{}}
+	if err := p.Read(context.Background(), "whole.md", []byte("---\ntitle: t\n---\nNo marker.\n")); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(p.Body), anchor) {
+		t.Errorf("got body %q; want no anchor", p.Body)
+	}
+	if want := "/post/whole"; p.ReadMoreLink != want {
+		t.Errorf("got %q; want %q", p.ReadMoreLink, want)
+	}
+}
+
+func TestExcerptDelimiter(t *testing.T) {
+	index := &Index{config: defaultConfig()}
+	if err := index.ReadFrontmatter([]byte(strings.Replace(testSettings, "---\n", "---\nexcerpt_delimiter: \"{{/* more */}}\"\n", 1))); err != nil {
+		t.Fatal(err)
+	}
+	index.config.Excerpt = []string{excerptMore}
+	p := &Post{Index: index}
+	if err := p.Read(context.Background(), "split.md", []byte("---\ntitle: t\n---\nTeaser.\n\n{{/* more */}}\n\nRest.\n")); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Teaser."; p.Excerpt != want {
+		t.Errorf("got excerpt %q; want %q", p.Excerpt, want)
+	}
+	if strings.Contains(string(p.Body), "more */") || !strings.Contains(string(p.Body), `<span id="more"></span>`) {
+		t.Errorf("got body %q; want the delimiter replaced by the anchor", p.Body)
+	}
+
+	if err := (&Index{}).ReadFrontmatter([]byte(strings.Replace(testSettings, "---\n", "---\nexcerpt_delimiter: \"\"\n", 1))); err == nil {
+		t.Error("got no error for an empty excerpt_delimiter")
+	}
+}
+
+func TestBuildAllGenerated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"first.md":  "---\ntitle: First\ndate: 2017-01-01\n---\nHello.\n",
+		"second.md": "---\ntitle: Second\ndate: 2017-01-02\n---\nWorld.\n",
+	})
+	config.Latest = true
+	if err := os.MkdirAll(path.Join(config.AssetsPath, "css"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(config.AssetsPath, "css", "main.css"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := buildAll(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := listFiles(config.OutputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestAssetManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, nil)
+	config.Fingerprint = true
+	if err := ioutil.WriteFile(path.Join(config.TemplatesPath, indexTmplFilename), []byte(`{{asset "main.css"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(config.AssetsPath, "main.css"), []byte("body { margin: 0; }\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buildAll(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(path.Join(config.OutputPath, manifestFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest map[string]string
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	want := "main.eac0e790573f.css"
+	if manifest["main.css"] != want {
+		t.Errorf("got %q; want %q", manifest["main.css"], want)
+	}
+	if _, err := os.Stat(path.Join(config.OutputPath, "assets", want)); err != nil {
+		t.Error(err)
+	}
+	index, err := ioutil.ReadFile(path.Join(config.OutputPath, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(index) != "/assets/"+want {
+		t.Errorf("got %q; want %q", index, "/assets/"+want)
+	}
+}
+
+func TestHomepageLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"a.md":     "---\ntitle: A\ndate: 2017-01-01\n---\nA.\n",
+		"b.md":     "---\ntitle: B\ndate: 2017-01-02\n---\nB.\n",
+		"c.md":     "---\ntitle: C\ndate: 2017-01-03\n---\nC.\n",
+		"draft.md": "---\ntitle: Draft\ndate: 2017-01-04\ndraft: true\n---\nDraft.\n",
+	})
+	config.HomepageLimit = 2
+	if _, err := buildAll(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	for filename, want := range map[string]string{
+		"index.html":    "C\nB\n",
+		archiveFilename: "C\nB\nA\n",
+	} {
+		got, err := ioutil.ReadFile(path.Join(config.OutputPath, filename))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("for %q got %q; want %q", filename, got, want)
+		}
+	}
+}
+
+func TestDraftsFeed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"published.md": "---\ntitle: Published\ndate: 2017-01-01\n---\nPublished.\n",
+		"pending.md":   "---\ntitle: Pending\ndate: 2017-01-02\ndraft: true\n---\nPending.\n",
+	})
+	drafts := path.Join(config.OutputPath, draftsFilename)
+
+	config.Preview = true
+	if _, err := buildAll(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(drafts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := xml.Header + "<rss><item><link>https://example.com/post/pending</link></item></rss>"; string(got) != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+
+	config.Preview = false
+	if _, err := buildAll(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(drafts); !os.IsNotExist(err) {
+		t.Errorf("got %v; want %q to not exist in a production build", err, draftsFilename)
+	}
+}
+
+func TestSkipDrafts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"published.md": "---\ntitle: Published\ndate: 2017-01-01\n---\nPublished.\n",
+		"pending.md":   "---\ntitle: Pending\ndate: 2017-01-02\ndraft: true\n---\nPending.\n",
+	})
+	page := path.Join(config.OutputPath, "post", "pending.html")
+
+	for _, drafts := range []bool{true, false} {
+		config.Drafts = drafts
+		if _, err := buildAll(context.Background(), config); err != nil {
+			t.Fatal(err)
+		}
+		feed, err := ioutil.ReadFile(path.Join(config.OutputPath, "index.xml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Contains(string(feed), "/post/pending"); got != drafts {
+			t.Errorf("with drafts %v: got the draft in the feed %v; want %v", drafts, got, drafts)
+		}
+		// a page written by a build with drafts doesn't outlive it
+		if _, err := os.Stat(page); os.IsNotExist(err) == drafts {
+			t.Errorf("with drafts %v: got %v for the draft page", drafts, err)
+		}
+	}
+}
+
+func TestBuildAllCanceled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"post.md": "---\ntitle: Post\ndate: 2017-01-01\n---\nPost.\n",
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := buildAll(ctx, config); err != context.Canceled {
+		t.Errorf("got %v; want %v", err, context.Canceled)
+	}
+	if _, err := os.Stat(path.Join(config.OutputPath, "index.html")); !os.IsNotExist(err) {
+		t.Errorf("got %v; want index.html to not exist after a canceled build", err)
+	}
+}
+
+func TestFeedImage(t *testing.T) {
+	tmpl := template.Must(template.ParseFiles(path.Join("example", "templates", feedTmplFilename)))
+	for text, want := range map[string]string{
+		testSettings: "",
+		strings.Replace(testSettings, "---\n", "---\nimage: /assets/logo.png\n", 1):                                                   "<image>\n      <url>https://example.com/assets/logo.png</url>\n      <title>Test</title>\n      <link>https://example.com/</link>",
+		strings.Replace(testSettings, "---\n", "---\nlogo:\n  url: https://cdn.example.com/logo.png\n  width: 88\n  height: 31\n", 1): "<url>https://cdn.example.com/logo.png</url>",
+	} {
+		index := &Index{}
+		if err := index.ReadFrontmatter([]byte(text)); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, index); err != nil {
+			t.Fatal(err)
+		}
+		got := buf.String()
+		if want == "" {
+			if strings.Contains(got, "<image>") {
+				t.Errorf("got %q; want no <image>", got)
+			}
+			continue
+		}
+		if !strings.Contains(got, want) {
+			t.Errorf("got %q; want it to contain %q", got, want)
+		}
+	}
+}
+
+func TestMaintenanceHandler(t *testing.T) {
+	page := "<h1>Back soon</h1>"
+	h := MaintenanceHandler([]byte(page), 30*time.Minute)
+	for _, target := range []string{"/", "/post/hello", "/assets/main.css"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("for %q got status %d; want %d", target, w.Code, http.StatusServiceUnavailable)
+		}
+		if got := w.Header().Get("Retry-After"); got != "1800" {
+			t.Errorf("for %q got Retry-After %q; want %q", target, got, "1800")
+		}
+		if got := w.Body.String(); got != page {
+			t.Errorf("for %q got body %q; want %q", target, got, page)
+		}
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	index := &Index{URL: "https://example.com/"}
+	for text, want := range map[string]string{
+		"---\ntitle: t\n---\nBody.\n":                                            "https://example.com/post/post",
+		"---\ntitle: t\ncanonical: https://original.com/2017/post\n---\nBody.\n": "https://original.com/2017/post",
+	} {
+		p := &Post{Index: index}
+		if err := p.Read(context.Background(), "post.md", []byte(text)); err != nil {
+			t.Fatal(err)
+		}
+		if p.Canonical != want {
+			t.Errorf("got %q; want %q", p.Canonical, want)
+		}
+	}
+
+	p := &Post{Index: index}
+	if err := p.Read(context.Background(), "post.md", []byte("---\ntitle: t\ncanonical: /relative\n---\nBody.\n")); err == nil {
+		t.Error("got nil error for a relative canonical URL")
+	}
+	if err := p.Read(context.Background(), "post.md", []byte("---\ntitle: t\ncanonical: 1\n---\nBody.\n")); errorString(err) != "post.md: invalid canonical: expected a string, got 1" {
+		t.Errorf("got %v; want an invalid canonical error", err)
+	}
+}
+
+func TestPostsDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"hello.md": "---\ntitle: Hello\ndate: 2017-01-01\n---\nHello.\n",
+	})
+	config.PostsDir = "blog"
+	generated, err := buildAll(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "blog/hello.html"; !strings.Contains(strings.Join(generated, "\n"), want) {
+		t.Errorf("got %q; want it to contain %q", generated, want)
+	}
+
+	feed, err := ioutil.ReadFile(path.Join(config.OutputPath, "index.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<link>https://example.com/blog/hello</link>"; !strings.Contains(string(feed), want) {
+		t.Errorf("got %q; want it to contain %q", feed, want)
+	}
+
+	mux := serveMux(config, "")
+	for target, wantCode := range map[string]int{
+		"/blog/hello": http.StatusOK,
+		"/blog/":      http.StatusNotFound,
+		"/post/hello": http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		if w.Code != wantCode {
+			t.Errorf("for %q got status %d; want %d", target, w.Code, wantCode)
+		}
+	}
+}
+
+func TestIndexParams(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		settingsFilename: strings.Replace(testSettings, "---\n", "---\nparams:\n  analytics: UA-1234\n  social:\n    twitter: gopher\n", 1),
+		"hello.md":       "---\ntitle: Hello\ndate: 2017-01-01\n---\nHello.\n",
+	})
+	for name, text := range map[string]string{
+		postTmplFilename:  "{{.Index.Params.analytics}} {{.Index.Params.social.twitter}}",
+		indexTmplFilename: "{{.Params.analytics}} {{.Params.social.twitter}}",
+	} {
+		if err := ioutil.WriteFile(path.Join(config.TemplatesPath, name), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := buildAll(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, filename := range []string{"index.html", "post/hello.html"} {
+		got, err := ioutil.ReadFile(path.Join(config.OutputPath, filename))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "UA-1234 gopher"; string(got) != want {
+			t.Errorf("for %q got %q; want %q", filename, got, want)
+		}
+	}
+}
+
+func TestDuplicateTitles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"a.md":     "---\ntitle: Same\ndate: 2017-01-01\n---\nA.\n",
+		"b.md":     "---\ntitle: Same\ndate: 2017-01-02\n---\nB.\n",
+		"c.md":     "---\ntitle: Different\ndate: 2017-01-03\n---\nC.\n",
+		"draft.md": "---\ntitle: Different\ndate: 2017-01-04\ndraft: true\n---\nDraft.\n",
+	})
+
+	logs, restore := captureLogs(logNormal)
+	defer restore()
+	if _, err := buildAll(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf("warning: duplicate title %q in %s, %s", "Same", path.Join(config.SourcePath, "a.md"), path.Join(config.SourcePath, "b.md"))
+	if got := logs.String(); !strings.Contains(got, want) || strings.Count(got, "duplicate title") != 1 {
+		t.Errorf("got logs %q; want exactly one warning %q", got, want)
+	}
+
+	config.Strict = true
+	if _, err := buildAll(context.Background(), config); err == nil || !strings.Contains(err.Error(), `duplicate title "Same"`) {
+		t.Errorf("got error %v; want duplicate title error in strict mode", err)
+	}
+}
+
+func TestGUID(t *testing.T) {
+	text := "---\ntitle: t\ndate: 2017-01-21\n---\nBody.\n"
+	for scheme, want := range map[string]string{
+		"link":   "https://example.com/post/context",
+		"taguri": "tag:example.com,2017-01-21:/post/context",
+		"hash":   fmt.Sprintf("%x", sha256.Sum256([]byte("Body.\n"))),
+	} {
+		config := defaultConfig()
+		config.GUID = scheme
+		p := &Post{Index: &Index{URL: "https://example.com/", config: config}}
+		if err := p.Read(context.Background(), "context.md", []byte(text)); err != nil {
+			t.Fatal(err)
+		}
+		if p.GUID != want {
+			t.Errorf("for %q got %q; want %q", scheme, p.GUID, want)
+		}
+		if wantPermaLink := scheme == "link"; p.GUIDPermaLink != wantPermaLink {
+			t.Errorf("for %q got GUIDPermaLink %v; want %v", scheme, p.GUIDPermaLink, wantPermaLink)
+		}
+	}
+}
+
+func TestExampleFeedGUID(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"hello.md": "---\ntitle: Hello\ndate: 2017-01-02\n---\nHello.\n",
+	})
+	config.TemplatesPath = path.Join("example", "templates")
+	for scheme, want := range map[string]string{
+		guidLink: `<guid isPermaLink="true">https://example.com/post/hello</guid>`,
+		guidHash: fmt.Sprintf(`<guid isPermaLink="false">%x</guid>`, sha256.Sum256([]byte("Hello.\n"))),
+	} {
+		config.GUID = scheme
+		// rebuilding keeps the GUIDs, so readers don't see the posts as new
+		for i := 0; i < 2; i++ {
+			if _, err := buildAll(context.Background(), config); err != nil {
+				t.Fatal(err)
+			}
+			feed, err := ioutil.ReadFile(path.Join(config.OutputPath, "index.xml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(feed), want) {
+				t.Errorf("with %s GUIDs got feed %q; want it to contain %q", scheme, feed, want)
+			}
+		}
+	}
+}
+
+func TestIndexOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"hello.md": "---\ntitle: Hello\ndate: 2017-01-01\n---\nHello.\n",
+	})
+	if _, err := buildAll(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	postFilename := path.Join(config.OutputPath, "post", "hello.html")
+	if err := ioutil.WriteFile(postFilename, []byte("untouched"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(config.SourcePath, "hello.md"), []byte("---\ntitle: Changed\ndate: 2017-01-01\n---\nHello.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config.IndexOnly = true
+	generated, err := buildAll(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ioutil.ReadFile(postFilename); err != nil || string(got) != "untouched" {
+		t.Errorf("got %q, %v; want the post left untouched", got, err)
+	}
+	if got, err := ioutil.ReadFile(path.Join(config.OutputPath, "index.html")); err != nil || string(got) != "Changed\n" {
+		t.Errorf("got %q, %v; want the index rebuilt", got, err)
+	}
+	for _, filename := range generated {
+		if strings.HasPrefix(filename, "post/") {
+			t.Errorf("got %q generated in index-only mode", filename)
+		}
+	}
+
+	if !isIndexTemplate(config, path.Join(config.TemplatesPath, indexTmplFilename)) || isIndexTemplate(config, path.Join(config.TemplatesPath, postTmplFilename)) {
+		t.Error("got the wrong templates detected as index-only")
+	}
+}
+
+func TestSubdir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"hello.md": "---\ntitle: Hello\ndate: 2017-01-01\n---\nHello.\n",
+	})
+	config.Subdir = "feature-x"
+	if _, err := buildAll(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	feed, err := ioutil.ReadFile(path.Join(config.OutputPath, "feature-x", "index.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<link>https://example.com/feature-x/post/hello</link>"; !strings.Contains(string(feed), want) {
+		t.Errorf("got %q; want it to contain %q", feed, want)
+	}
+	if _, err := os.Stat(path.Join(config.OutputPath, "feature-x", "post", "hello.html")); err != nil {
+		t.Error(err)
+	}
+
+	index := &Index{config: config}
+	if err := index.ReadFrontmatter([]byte(testSettings)); err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://example.com/feature-x/index.xml"; index.XMLURL != want {
+		t.Errorf("got %q; want %q", index.XMLURL, want)
+	}
+	post := &Post{Index: index}
+	if err := post.Read(context.Background(), "hello.md", []byte("---\ntitle: Hello\n---\nHello.\n")); err != nil {
+		t.Fatal(err)
+	}
+	if want := "/feature-x/post/hello"; post.RelativeLink != want {
+		t.Errorf("got %q; want %q", post.RelativeLink, want)
+	}
+	if got, want := templateFuncs(config.assetsURL(), nil)["asset"].(func(string) string)("main.css"), "/feature-x/assets/main.css"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestBranchSubdir(t *testing.T) {
+	defer os.Setenv("BLGO_BRANCH", os.Getenv("BLGO_BRANCH"))
+	os.Setenv("BLGO_BRANCH", "feature/new theme")
+	if got, err := branchSubdir(); err != nil || got != "feature-new-theme" {
+		t.Errorf("got %q, %v; want %q", got, err, "feature-new-theme")
+	}
+}
+
+func TestTemplateParseError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, nil)
+	broken := path.Join(config.TemplatesPath, indexTmplFilename)
+	if err := ioutil.WriteFile(broken, []byte("{{range .Posts}}\n{{.Title}\n{{end}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = buildAll(context.Background(), config)
+	if got := errorString(err); !strings.HasPrefix(got, broken+": ") || !strings.Contains(got, indexTmplFilename+":2:") {
+		t.Errorf("got %q; want an error naming %s and line 2", got, broken)
+	}
+}
+
+func TestDefaultDraft(t *testing.T) {
+	for settings, want := range map[string]bool{
+		"":                       false,
+		"default_draft: false\n": false,
+		"default_draft: true\n":  true,
+	} {
+		index := &Index{}
+		if err := index.ReadFrontmatter([]byte(strings.Replace(testSettings, "---\n", "---\n"+settings, 1))); err != nil {
+			t.Fatal(err)
+		}
+		post := &Post{Index: index}
+		if err := post.Read(context.Background(), "hello.md", []byte("---\ntitle: Hello\n---\nHello.\n")); err != nil {
+			t.Fatal(err)
+		}
+		if post.Draft != want {
+			t.Errorf("for %q got draft %v; want %v", settings, post.Draft, want)
+		}
+
+		published := &Post{Index: index}
+		if err := published.Read(context.Background(), "hello.md", []byte("---\ntitle: Hello\ndraft: false\n---\nHello.\n")); err != nil {
+			t.Fatal(err)
+		}
+		if published.Draft {
+			t.Errorf("for %q got an explicitly published post as a draft", settings)
+		}
+	}
+
+	index := &Index{}
+	if err := index.ReadFrontmatter([]byte(strings.Replace(testSettings, "---\n", "---\ndefault_draft: yes please\n", 1))); err == nil {
+		t.Error("got no error for a non-bool default_draft")
+	}
+
+	post := &Post{Index: &Index{}}
+	if err := post.Read(context.Background(), "hello.md", []byte("---\ntitle: Hello\ndraft: 1\n---\nHello.\n")); errorString(err) != "hello.md: invalid draft: expected a bool, got 1" {
+		t.Errorf("got %v; want an invalid draft error", err)
+	}
+}
+
+func TestTitleHeading(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"hello.md": "---\ndate: 2017-01-01\n---\n```\n# not a title\n```\n\n# Hello, World #\n\nHello.\n\n# Another\n",
+	})
+	if _, err := buildAll(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(path.Join(config.OutputPath, "post", "hello.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(got), "Hello, World\n") {
+		t.Errorf("got %q; want the title read from the first H1", got)
+	}
+	if strings.Contains(string(got), "World</") {
+		t.Errorf("got %q; want the title heading stripped from the body", got)
+	}
+	if !strings.Contains(string(got), "Another") {
+		t.Errorf("got %q; want the later headings kept", got)
+	}
+
+	config.StripTitleHeading = false
+	index := &Index{config: config}
+	post := &Post{Index: index}
+	if err := post.Read(context.Background(), "hello.md", []byte("---\n---\n# Hello\n\nHello.\n")); err != nil {
+		t.Fatal(err)
+	}
+	if post.Title != "Hello" || !strings.Contains(string(post.Body), "<h1") {
+		t.Errorf("got title %q and body %q; want the heading kept", post.Title, post.Body)
+	}
+
+	post = &Post{Index: &Index{}}
+	if err := post.Read(context.Background(), "year.md", []byte("---\ntitle: 2024\n---\n# Hello\n")); errorString(err) != "year.md: invalid title: expected a string, got 2024" {
+		t.Errorf("got %v; want an invalid title error", err)
+	}
+}
+
+func TestRecent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"a.md": "---\ntitle: A\ndate: 2017-01-01\n---\nA.\n",
+		"b.md": "---\ntitle: B\ndate: 2017-01-02\n---\nB.\n",
+		"c.md": "---\ntitle: C\ndate: 2017-01-03\n---\nC.\n",
+		"d.md": "---\ntitle: D\ndate: 2017-01-04\ndraft: true\n---\nD.\n",
+	})
+	config.Recent = 2
+	if err := ioutil.WriteFile(path.Join(config.TemplatesPath, recentTmplFilename), []byte("{{range .Posts}}{{.Title}}\n{{end}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buildAll(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(path.Join(config.OutputPath, recentFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "C\nB\n"; string(got) != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestFeedXMLDeclaration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, nil)
+	for tmpl, wantErr := range map[string]bool{
+		"\n<rss><item><title>{{range .Posts}}{{.XMLTitle}}{{end}}</title></item></rss>":                                            false,
+		`<?xml version="1.0" encoding="UTF-8"?>` + "\n<rss><item><title>{{range .Posts}}{{.XMLTitle}}{{end}}</title></item></rss>": false,
+		`<?xml version="1.0" encoding="ISO-8859-1"?>` + "\n<rss></rss>":                                                            true,
+	} {
+		if err := ioutil.WriteFile(path.Join(config.TemplatesPath, feedTmplFilename), []byte(tmpl), 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := executeFeedFile(template.Must(parseTemplates(template.New(""), templateFilenames(config)...)), path.Join(config.OutputPath, "index.xml"), feedTmplFilename, &Index{Posts: []*Post{{XMLTitle: "Fish &amp; Chips"}}})
+		if wantErr {
+			if err == nil {
+				t.Errorf("for %q got no error for a non-UTF-8 declaration", tmpl)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadFile(path.Join(config.OutputPath, "index.xml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(got, []byte(`<?xml version="1.0" encoding="UTF-8"?>`+"\n<rss>")) {
+			t.Errorf("got %q; want it to start with the XML declaration", got)
+		}
+		var feed struct {
+			Title string `xml:"item>title"`
+		}
+		if err := xml.Unmarshal(got, &feed); err != nil {
+			t.Errorf("got invalid XML %q: %v", got, err)
+		}
+		if feed.Title != "Fish & Chips" {
+			t.Errorf("got title %q; want %q", feed.Title, "Fish & Chips")
+		}
+	}
+}
+
+func TestUndefinedTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"hello.md": "---\ntitle: Hello\ndate: 2017-01-01\n---\nHello.\n",
+	})
+	if err := ioutil.WriteFile(path.Join(config.TemplatesPath, postTmplFilename), []byte(`{{if .Title}}{{template "missing" .}}{{end}}{{.Title}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buildAll(context.Background(), config); errorString(err) != `template "missing" is referenced but not defined` {
+		t.Errorf("got %v; want an undefined template error", err)
+	}
+
+	logs, restore := captureLogs(logNormal)
+	defer restore()
+	config.LenientTemplates = true
+	if _, err := buildAll(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), `warning: template "missing" is referenced but not defined`) {
+		t.Errorf("got logs %q; want a warning about the missing template", logs.String())
+	}
+	got, err := ioutil.ReadFile(path.Join(config.OutputPath, "post", "hello.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "Hello" {
+		t.Errorf("got %q; want %q", got, "Hello")
+	}
+}
+
+func TestFeedUpdatedAt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"old.md":   "---\ntitle: Old\ndate: 2017-01-01\nupdated: 2017-04-01\n---\nOld.\n",
+		"new.md":   "---\ntitle: New\ndate: 2017-03-04\n---\nNew.\n",
+		"draft.md": "---\ntitle: Draft\ndate: 2017-05-06\ndraft: true\n---\nDraft.\n",
+	})
+	if err := ioutil.WriteFile(path.Join(config.TemplatesPath, feedTmplFilename), []byte(`<rss>{{.UpdatedAt.Format "2006-01-02"}}</rss>`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for updatedNow, want := range map[bool]string{
+		false: "2017-04-01",
+		true:  time.Now().Format("2006-01-02"),
+	} {
+		config.UpdatedNow = updatedNow
+		if _, err := buildAll(context.Background(), config); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadFile(path.Join(config.OutputPath, "index.xml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := xml.Header + "<rss>" + want + "</rss>"; string(got) != want {
+			t.Errorf("with UpdatedNow %v got %q; want %q", updatedNow, got, want)
+		}
+	}
+}
+
+func TestPostUpdated(t *testing.T) {
+	for frontmatter, want := range map[string]string{
+		"date: 2017-01-01\n":                      "2017-01-01",
+		"date: 2017-01-01\nupdated: 2017-02-03\n": "2017-02-03",
+		"date: 2017-01-01\nupdated: [soon]\n":     "x.md: invalid updated: expected a date, got [soon]",
+		"date: 2017-01-01\nupdated: 2017-02-30\n": `x.md: invalid updated: parsing time "2017-02-30": expected one of the formats 2006-01-02, 2006-01-02T15:04:05Z07:00, 2006-01-02 15:04:05, 2006-01-02 15:04, Jan 2, 2006, January 2, 2006`,
+	} {
+		post := &Post{Index: &Index{}}
+		err := post.Read(context.Background(), "x.md", []byte("---\ntitle: X\n"+frontmatter+"---\nX.\n"))
+		got := errorString(err)
+		if err == nil {
+			got = post.Updated.Format(shortTimeFormat)
+		}
+		if got != want {
+			t.Errorf("for %q got %q; want %q", frontmatter, got, want)
+		}
+	}
+}
+
+func TestSummary(t *testing.T) {
+	for body, want := range map[string]string{
+		"Teaser one.\n\n<!--more-->\n\nRest.\n":          "<p>Teaser one.</p>\n",
+		"Teaser <em>inline <!--more--> cut</em> rest.\n": "<p>Teaser <em>inline </em></p>",
+		"First.\n\nSecond.\n":                            "<p>First.</p>",
+		"# Only a heading\n":                             "<h1>Only a heading</h1>\n",
+	} {
+		post := &Post{Index: &Index{}}
+		if err := post.Read(context.Background(), "x.md", []byte("---\ntitle: X\n---\n"+body)); err != nil {
+			t.Fatal(err)
+		}
+		if string(post.Summary) != want {
+			t.Errorf("for %q got summary %q; want %q", body, post.Summary, want)
+		}
+	}
+}
+
+func TestReadingTime(t *testing.T) {
+	for words, want := range map[int]int{400: 2, 401: 3, 1: 1, 0: 0} {
+		// words split across markup still count once
+		body := strings.Repeat("<em>word</em> ", words)
+		post := &Post{Index: &Index{}}
+		if err := post.Read(context.Background(), "x.md", []byte("---\ntitle: X\n---\n"+body+"\n")); err != nil {
+			t.Fatal(err)
+		}
+		if post.WordCount != words || post.ReadingTime != want {
+			t.Errorf("for %d words got %d words and %d minutes; want %d and %d", words, post.WordCount, post.ReadingTime, words, want)
+		}
+	}
+}
+
+func TestPostParams(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"hello.md": "---\ntitle: Hello\ndate: 2017-01-01\nsubtitle: A greeting\nsocial:\n  twitter: gopher\n---\nHello.\n",
+	})
+	tmpl := `{{.Title}} {{index .Params "subtitle"}} {{.Params.social.twitter}} {{.Params.date}}`
+	if err := ioutil.WriteFile(path.Join(config.TemplatesPath, postTmplFilename), []byte(tmpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buildAll(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(path.Join(config.OutputPath, "post/hello.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Hello A greeting gopher 2017-01-01"; string(got) != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestPrevNext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"a.md": "---\ntitle: A\ndate: 2017-01-01\n---\nA.\n",
+		"b.md": "---\ntitle: B\ndate: 2017-01-02\n---\nB.\n",
+		"c.md": "---\ntitle: C\ndate: 2017-01-03\ndraft: true\n---\nC.\n",
+		"d.md": "---\ntitle: D\ndate: 2017-01-04\n---\nD.\n",
+	})
+	nav := "{{with .Prev}}{{.Title}}{{end}}|{{with .Next}}{{.Title}}{{end}}"
+	if err := ioutil.WriteFile(path.Join(config.TemplatesPath, postTmplFilename), []byte(nav), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// drafts in the build are still skipped as neighbors
+	config.Drafts = true
+	if _, err := buildAll(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	for slug, want := range map[string]string{
+		"a": "|B",
+		"b": "A|D",
+		"c": "|",
+		"d": "B|",
+	} {
+		got, err := ioutil.ReadFile(path.Join(config.OutputPath, config.PostsDir, slug+".html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s: got %q; want %q", slug, got, want)
+		}
+	}
+}
+
+func TestQuiet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"a.md": "---\ntitle: Same\ndate: 2017-01-01\n---\nA.\n",
+		"b.md": "---\ntitle: Same\ndate: 2017-01-02\n---\nB.\n",
+	})
+
+	logs, restore := captureLogs(logQuiet)
+	defer restore()
+
+	if _, err := buildAll(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	if logs.Len() != 0 {
+		t.Errorf("got logs %q; want none in quiet mode", logs.String())
+	}
+
+	config.Strict = true
+	if _, err := buildAll(context.Background(), config); err == nil {
+		t.Error("got no error in quiet mode; want the duplicate title error")
+	}
+}
+
+func TestLenient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"My Note.md": "Just some notes.\n",
+		"rule.md":    "Before the rule.\n\n---\n\nAfter the rule.\n",
+	})
+	modTime := time.Date(2017, 2, 3, 4, 5, 6, 0, time.UTC)
+	bare := path.Join(config.SourcePath, "My Note.md")
+	if err := os.Chtimes(bare, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	post := &Post{Index: &Index{config: config}}
+	if err := post.ReadFile(context.Background(), bare); errorString(err) != bare+": missing frontmatter delimiter" {
+		t.Errorf("got %v; want a missing frontmatter error", err)
+	}
+
+	config.Lenient = true
+	if _, err := buildAll(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(path.Join(config.OutputPath, "post", "My Note.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "my-note\n<p>Just some notes.</p>\n"; string(got) != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+	got, err = ioutil.ReadFile(path.Join(config.OutputPath, "post", "rule.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"<p>Before the rule.</p>", "<hr", "<p>After the rule.</p>"} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("got %q; want it to contain %q", got, want)
+		}
+	}
+
+	post = &Post{Index: &Index{config: config}}
+	if err := post.ReadFile(context.Background(), bare); err != nil {
+		t.Fatal(err)
+	}
+	if !post.Date.Equal(modTime) {
+		t.Errorf("got date %v; want the modification time %v", post.Date, modTime)
+	}
+}
+
+func TestLenientShortcodeStart(t *testing.T) {
+	config := defaultConfig()
+	config.Lenient = true
+	post := &Post{Index: &Index{config: config}}
+	if err := post.Read(context.Background(), "video.md", []byte("{{< youtube abc >}}\n\nA video.\n")); err != nil {
+		t.Fatalf("got %v; want a bare post starting with a shortcode", err)
+	}
+	if !strings.Contains(string(post.Body), "youtube.com/embed/abc") {
+		t.Errorf("got body %q; want the expanded shortcode", post.Body)
+	}
+}
+
+func TestBodyAndTextLength(t *testing.T) {
+	post := &Post{Index: &Index{}}
+	if err := post.Read(context.Background(), "hello.md", []byte("---\ntitle: Hello\n---\nHéllo **wörld**.\n")); err != nil {
+		t.Fatal(err)
+	}
+	// <p>Héllo <strong>wörld</strong>.</p>\n
+	if want := 39; post.BodyLength != want {
+		t.Errorf("got body length %d; want %d", post.BodyLength, want)
+	}
+	// Héllo wörld.
+	if want := 12; post.TextLength != want {
+		t.Errorf("got text length %d; want %d", post.TextLength, want)
+	}
+}
+
+func TestWriteFileAtomicRetries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(backoff time.Duration) { writeBackoff = backoff }(writeBackoff)
+	writeBackoff = time.Millisecond
+
+	calls := 0
+	filename := path.Join(dir, "index.html")
+	err = writeFileAtomic(filename, func(w io.Writer) error {
+		calls++
+		if calls == 1 {
+			return &os.PathError{Op: "write", Path: filename, Err: syscall.EAGAIN}
+		}
+		_, err := io.WriteString(w, "hello")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ioutil.ReadFile(filename); err != nil || string(got) != "hello" || calls != 2 {
+		t.Errorf("got %q, %v after %d calls; want %q after 2", got, err, calls, "hello")
+	}
+
+	calls = 0
+	err = writeFileAtomic(filename, func(w io.Writer) error {
+		calls++
+		return &os.PathError{Op: "open", Path: filename, Err: syscall.ENOENT}
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("got %v after %d calls; want a permanent error after 1", err, calls)
+	}
+}
+
+func TestAssetsPrefix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"hello.md": "---\ntitle: Hello\ndate: 2017-01-01\n---\nHello.\n",
+	})
+	config.AssetsPrefix = "static"
+	if err := ioutil.WriteFile(path.Join(config.AssetsPath, "main.css"), []byte("body {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(config.TemplatesPath, indexTmplFilename), []byte(`{{asset "main.css"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buildAll(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ioutil.ReadFile(path.Join(config.OutputPath, "index.html")); err != nil || string(got) != "/static/main.css" {
+		t.Errorf("got %q, %v; want %q", got, err, "/static/main.css")
+	}
+	if _, err := os.Stat(path.Join(config.OutputPath, "static", "main.css")); err != nil {
+		t.Error(err)
+	}
+
+	mux := serveMux(config, config.AssetsPath)
+	for target, wantCode := range map[string]int{
+		"/static/main.css": http.StatusOK,
+		"/assets/main.css": http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		if w.Code != wantCode {
+			t.Errorf("for %q got status %d; want %d", target, w.Code, wantCode)
+		}
+	}
+}
+
+func TestBasePath(t *testing.T) {
+	for _, test := range []struct {
+		settings  string
+		wantIndex string
+		served    string
+	}{
+		{"url: https://example.com/\n", "/assets/main.css /post/hello", "/post/hello"},
+		{"url: https://example.com/blog/\n", "/blog/assets/main.css /blog/post/hello", "/blog/post/hello"},
+		{"url: https://example.com/\nbasepath: /preview/\n", "/preview/assets/main.css /preview/post/hello", "/preview/post/hello"},
+	} {
+		dir, err := ioutil.TempDir("", "blgo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		settings := strings.Replace(testSettings, "url: https://example.com/\n", test.settings, 1)
+		config := newTestSite(t, dir, map[string]string{
+			settingsFilename: settings,
+			"hello.md":       "---\ntitle: Hello\ndate: 2017-01-01\n---\nHello.\n",
+		})
+		if err := ioutil.WriteFile(path.Join(config.AssetsPath, "main.css"), []byte("body {}\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path.Join(config.TemplatesPath, indexTmplFilename), []byte(`{{asset "main.css"}}{{range .Posts}} {{.RelativeLink}}{{end}}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := buildAll(context.Background(), config); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := ioutil.ReadFile(path.Join(config.OutputPath, "index.html")); err != nil || string(got) != test.wantIndex {
+			t.Errorf("for %q got %q, %v; want %q", test.settings, got, err, test.wantIndex)
+		}
+
+		index := &Index{config: config}
+		if err := index.ReadFrontmatter([]byte(settings)); err != nil {
+			t.Fatal(err)
+		}
+		handler := BasePathHandler(index.basePath, serveMux(config, config.AssetsPath))
+		for _, target := range []string{test.served, strings.TrimSuffix(test.served, "post/hello") + "assets/main.css"} {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+			if w.Code != http.StatusOK {
+				t.Errorf("for %q got status %d serving %q; want %d", test.settings, w.Code, target, http.StatusOK)
+			}
+		}
+	}
+}
+
+func TestServeShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() {
+		served <- serve(ctx, "127.0.0.1:0", http.NotFoundHandler())
+	}()
+	cancel()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("got %v; want no error after a clean shutdown", err)
+		}
+	case <-time.After(shutdownTimeout):
+		t.Fatal("serve didn't return after ctx was done")
+	}
+
+	if err := serve(context.Background(), "127.0.0.1:-1", http.NotFoundHandler()); err == nil {
+		t.Error("got no error for an invalid address")
+	}
+}
+
+func TestFeedCategories(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"hello.md": "---\ntitle: Hello\ndate: 2017-01-01\ntags: [go, R&D]\n---\nHello.\n",
+	})
+	config.TemplatesPath = path.Join("example", "templates")
+	if _, err := buildAll(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(path.Join(config.OutputPath, "index.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var feed struct {
+		Categories []string `xml:"channel>item>category"`
+	}
+	if err := xml.Unmarshal(got, &feed); err != nil {
+		t.Fatalf("got invalid XML %q: %v", got, err)
+	}
+	if want := []string{"go", "R&D"}; !reflect.DeepEqual(feed.Categories, want) {
+		t.Errorf("got categories %q; want %q", feed.Categories, want)
+	}
+}
+
+func TestDistinctDates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"a.md":   "---\ntitle: A\ndate: 2017-01-02\n---\nA.\n",
+		"b.md":   "---\ntitle: B\ndate: 2017-01-02\n---\nB.\n",
+		"old.md": "---\ntitle: Old\ndate: 2017-01-01\n---\nOld.\n",
+	})
+	if err := ioutil.WriteFile(path.Join(config.TemplatesPath, feedTmplFilename), []byte(`<rss>{{range .Posts}}{{.Title}} {{.FeedDate.Format "2006-01-02 15:04"}};{{end}}</rss>`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for distinct, want := range map[bool]string{
+		false: "A 2017-01-02 00:00;B 2017-01-02 00:00;Old 2017-01-01 00:00;",
+		true:  "A 2017-01-02 00:01;B 2017-01-02 00:00;Old 2017-01-01 00:00;",
+	} {
+		config.DistinctDates = distinct
+		if _, err := buildAll(context.Background(), config); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadFile(path.Join(config.OutputPath, "index.xml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := xml.Header + "<rss>" + want + "</rss>"; string(got) != want {
+			t.Errorf("with DistinctDates %v got %q; want %q", distinct, got, want)
+		}
+	}
+}
+
+func TestReadPostsErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sources := map[string]string{}
+	for i := 0; i < 20; i++ {
+		sources[fmt.Sprintf("ok%02d.md", i)] = fmt.Sprintf("---\ntitle: Post %d\ndate: 2017-01-01\n---\nHello.\n", i)
+	}
+	sources["bad1.md"] = "---\ndate: 2017-01-01\n---\nNo title.\n"
+	sources["bad2.md"] = "---\ntitle: Bad\ndate: someday\n---\nBad date.\n"
+	config := newTestSite(t, dir, sources)
+
+	_, err = buildAll(context.Background(), config)
+	errs, ok := err.(postErrors)
+	if !ok {
+		t.Fatalf("got %v; want postErrors", err)
+	}
+	if len(errs) != 2 || !strings.Contains(errs[0].Error(), "bad1.md") || !strings.Contains(errs[1].Error(), "bad2.md") {
+		t.Errorf("got errors %q; want those of bad1.md and bad2.md in order", errs)
+	}
+
+	// the posts keep the order of the files however they are read
+	os.Remove(path.Join(config.SourcePath, "bad1.md"))
+	os.Remove(path.Join(config.SourcePath, "bad2.md"))
+	index := &Index{config: config}
+	files, err := listSourceFiles(config.SourcePath, config.sourceExts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	posts, err := readPosts(context.Background(), index, config.SourcePath, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 20 {
+		t.Fatalf("got %d posts; want 20", len(posts))
+	}
+	for i, post := range posts {
+		if want := fmt.Sprintf("Post %d", i); post.Title != want {
+			t.Errorf("got post %d %q; want %q", i, post.Title, want)
+		}
+	}
+}
+
+func TestBuildJobs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sources := map[string]string{}
+	for i := 0; i < 20; i++ {
+		sources[fmt.Sprintf("post%02d.md", i)] = fmt.Sprintf("---\ntitle: Post %d\ndate: 2017-01-%02d\n---\nHello.\n", i, i+1)
+	}
+	config := newTestSite(t, dir, sources)
+	// the posts read the images of their neighbors while others are written
+	config.OGImages = true
+	if err := ioutil.WriteFile(path.Join(config.TemplatesPath, postTmplFilename), []byte("{{.Title}} {{.Image}}{{with .Prev}} {{.Image}}{{end}}{{with .Next}} {{.Image}}{{end}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var outputs []string
+	for _, jobs := range []int{1, 4} {
+		config.Jobs = jobs
+		generated, err := buildAll(context.Background(), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		index, err := ioutil.ReadFile(path.Join(config.OutputPath, "index.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, strings.Join(generated, " ")+"\n"+string(index))
+	}
+	if outputs[0] != outputs[1] {
+		t.Errorf("with 4 jobs got\n%s\nwant the same as with 1 job\n%s", outputs[1], outputs[0])
+	}
+	for i := 0; i < 20; i++ {
+		if !strings.Contains(outputs[1], fmt.Sprintf("post/post%02d.html", i)) {
+			t.Errorf("post%02d.html not generated", i)
+		}
+	}
+	got, err := ioutil.ReadFile(path.Join(config.OutputPath, "post", "post05.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Post 5 https://example.com/og/post05.png https://example.com/og/post04.png https://example.com/og/post06.png"; string(got) != want {
+		t.Errorf("got post %q; want %q", got, want)
+	}
+}
+
+func TestBuildAllErrors(t *testing.T) {
+	for name, test := range map[string]struct {
+		sources map[string]string
+		setup   func(config *Config)
+		want    string
+	}{
+		"post": {
+			sources: map[string]string{"untitled.md": "---\ndate: 2017-01-01\n---\nHello.\n"},
+			want:    "untitled.md: could not read the title from post",
+		},
+		"date": {
+			sources: map[string]string{"hello.md": "---\ntitle: Hello\ndate: yesterday\n---\nHello.\n"},
+			want:    `hello.md: parsing time "yesterday"`,
+		},
+		"settings": {
+			setup: func(config *Config) { os.Remove(path.Join(config.SourcePath, settingsFilename)) },
+			want:  `error in reading frontmatter of "_index.md"`,
+		},
+		"template": {
+			setup: func(config *Config) { os.Remove(path.Join(config.TemplatesPath, feedTmplFilename)) },
+			want:  feedTmplFilename,
+		},
+	} {
+		dir, err := ioutil.TempDir("", "blgo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		config := newTestSite(t, dir, test.sources)
+		if test.setup != nil {
+			test.setup(config)
+		}
+		if _, err := buildAll(context.Background(), config); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got %v; want an error containing %q", name, err, test.want)
+		}
+	}
+}
+
+func TestXMLDescTruncation(t *testing.T) {
+	for _, body := range []string{
+		"Hello you",
+		strings.Repeat("a", maxDescLength-2) + "😀 after the boundary",
+	} {
+		config := defaultConfig()
+		config.Excerpt = nil
+		p := &Post{Index: &Index{config: config}}
+		if err := p.Read(context.Background(), "short.md", []byte("---\ntitle: t\n---\n"+body+"\n")); err != nil {
+			t.Fatal(err)
+		}
+		if len(p.XMLDesc) > maxDescLength || !utf8.ValidString(p.XMLDesc) || !strings.HasPrefix(body, p.XMLDesc) {
+			t.Errorf("got description %q; want a valid UTF-8 prefix of %q of at most %d bytes", p.XMLDesc, body, maxDescLength)
+		}
+	}
+}
+
+func TestDescription(t *testing.T) {
+	config := defaultConfig()
+	config.Excerpt = []string{excerptParagraph}
+	p := &Post{Index: &Index{config: config}}
+	if err := p.Read(context.Background(), "post.md", []byte("---\ntitle: t\ndescription: Fish & chips\n---\nSee [the menu](https://example.com/menu).\n")); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Fish & chips"; p.Description != want {
+		t.Errorf("got description %q; want %q", p.Description, want)
+	}
+	if want := "Fish &amp; chips"; p.XMLDesc != want {
+		t.Errorf("got XML description %q; want %q", p.XMLDesc, want)
+	}
+
+	if err := p.Read(context.Background(), "post.md", []byte("---\ntitle: t\ndescription: [a, b]\n---\nBody.\n")); err == nil {
+		t.Error("got no error for a list description")
+	}
+}
+
+func TestSymlinkedDirectories(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"hello.md": "---\ntitle: Hello\ndate: 2017-01-02\n---\nHello.\n",
+	})
+	if err := ioutil.WriteFile(path.Join(config.AssetsPath, "style.css"), []byte("body {}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// the source and assets are reached through links, e.g. to a release
+	for _, p := range []*string{&config.SourcePath, &config.AssetsPath} {
+		link := *p + "-link"
+		if err := os.Symlink(*p, link); err != nil {
+			t.Skip(err)
+		}
+		*p = link
+	}
+	generated, err := buildAll(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"post/hello.html", "assets/style.css"} {
+		if !strings.Contains(strings.Join(generated, " "), want) {
+			t.Errorf("got generated %q; want %s", generated, want)
+		}
+		if info, err := os.Lstat(path.Join(config.OutputPath, want)); err != nil || !info.Mode().IsRegular() {
+			t.Errorf("got %v for %s; want a regular file", err, want)
+		}
+	}
+
+	// a cycle fails instead of listing nothing or looping
+	loop := path.Join(dir, "loop")
+	if err := os.Symlink(loop, loop); err != nil {
+		t.Fatal(err)
+	}
+	config.SourcePath = loop
+	if _, err := buildAll(context.Background(), config); err == nil {
+		t.Error("got no error for a cyclic source symlink")
+	}
+}
+
+func TestNestedSources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"top.md":            "---\ntitle: Top\ndate: 2017-01-01\n---\nTop.\n",
+		"2023/my-post.md":   "---\ntitle: Mine\ndate: 2023-01-01\n---\nMine.\n",
+		"2023/05/deep.md":   "---\ntitle: Deep\ndate: 2023-05-01\n---\nDeep.\n",
+		".drafts/hidden.md": "not a post",
+		"2023/notes.txt":    "not a post",
+		"2023/_index.md":    "not a post",
+		"2023/.git/HEAD.md": "not a post",
+		"2024/empty/.keep":  "",
+	})
+	generated, err := buildAll(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"post/top.html", "post/2023/my-post.html", "post/2023/05/deep.html"} {
+		if !strings.Contains(strings.Join(generated, " "), want) {
+			t.Errorf("got generated %q; want %s", generated, want)
+		}
+		if _, err := os.Stat(path.Join(config.OutputPath, want)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	index := &Index{config: config}
+	files, err := listSourceFiles(config.SourcePath, config.sourceExts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		if strings.Contains(file, "/.") || !strings.HasSuffix(file, ".md") {
+			t.Errorf("got file %q; want no hidden or non-markdown files", file)
+		}
+	}
+	posts, err := readPosts(context.Background(), index, config.SourcePath, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, post := range posts {
+		if post.Title != "Mine" {
+			continue
+		}
+		if post.Slug != "2023/my-post" || post.RelativeLink != "/post/2023/my-post" || post.OutputFilename != "post/2023/my-post.html" {
+			t.Errorf("got slug %q, link %q and output %q; want them under 2023", post.Slug, post.RelativeLink, post.OutputFilename)
+		}
+	}
+}
+
+func TestSiteBuildInfo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"hello.md": "---\ntitle: Hello\ndate: 2017-01-02\n---\nHello.\n",
+	})
+	footer := `{{.Site.BuildTime.Format "2006-01-02T15:04:05Z07:00"}} {{.Site.Commit}}`
+	if err := ioutil.WriteFile(path.Join(config.TemplatesPath, indexTmplFilename), []byte(footer), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("BLGO_COMMIT", os.Getenv("BLGO_COMMIT"))
+	os.Setenv("BLGO_COMMIT", "abc1234")
+
+	start := time.Now().Add(-time.Second)
+	if _, err := buildAll(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(path.Join(config.OutputPath, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := strings.Fields(string(got))
+	if len(fields) != 2 || fields[1] != "abc1234" {
+		t.Fatalf("got %q; want the build time and the commit", got)
+	}
+	built, err := time.Parse(time.RFC3339, fields[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if built.Before(start) || built.After(time.Now()) {
+		t.Errorf("got build time %v; want the time of the build", built)
+	}
+}
+
+func TestHTMLEscaping(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"xss.md": "---\ntitle: \"<script>alert(1)</script>\"\ndate: 2017-01-02\n---\nSome **bold** text.\n",
+	})
+	if _, err := buildAll(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	index, err := ioutil.ReadFile(path.Join(config.OutputPath, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "&lt;script&gt;alert(1)&lt;/script&gt;"; !strings.Contains(string(index), want) || strings.Contains(string(index), "<script>") {
+		t.Errorf("got index.html %q; want the title escaped as %q", index, want)
+	}
+	post, err := ioutil.ReadFile(path.Join(config.OutputPath, "post", "xss.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<strong>bold</strong>"; !strings.Contains(string(post), want) {
+		t.Errorf("got post %q; want the body markup %q kept", post, want)
+	}
+	// the feed data is escaped for XML already and must not be escaped twice
+	feed, err := ioutil.ReadFile(path.Join(config.OutputPath, "index.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<link>https://example.com/post/xss</link>"; !strings.Contains(string(feed), want) {
+		t.Errorf("got feed %q; want it to contain %q", feed, want)
+	}
+
+	// the example theme is valid for html/template
+	config.TemplatesPath = path.Join("example", "templates")
+	config.Recent = 5
+	if _, err := buildAll(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPostImage(t *testing.T) {
+	index := &Index{config: defaultConfig()}
+	if err := index.ReadFrontmatter([]byte(strings.Replace(testSettings, "url: https://example.com/", "url: https://example.com/blog/", 1))); err != nil {
+		t.Fatal(err)
+	}
+	for frontmatter, want := range map[string]string{
+		"":                           "",
+		"image: cover.png\n":         "https://example.com/blog/assets/cover.png",
+		"cover: img/cover.png\n":     "https://example.com/blog/assets/img/cover.png",
+		"image: /static/cover.png\n": "https://example.com/static/cover.png",
+		"image: https://cdn.example.com/cover.png\n": "https://cdn.example.com/cover.png",
+	} {
+		post := &Post{Index: index}
+		if err := post.Read(context.Background(), "hello.md", []byte("---\ntitle: Hello\n"+frontmatter+"---\nHello.\n")); err != nil {
+			t.Fatal(err)
+		}
+		if post.Image != want {
+			t.Errorf("for %q got image %q; want %q", frontmatter, post.Image, want)
+		}
+		wantCard := "summary_large_image"
+		if want == "" {
+			wantCard = "summary"
+		}
+		if got := post.TwitterCard(); got != wantCard {
+			t.Errorf("for %q got Twitter card %q; want %q", frontmatter, got, wantCard)
+		}
+	}
+
+	post := &Post{Index: index}
+	if err := post.Read(context.Background(), "hello.md", []byte("---\ntitle: Hello\nimage: [a, b]\n---\nHello.\n")); errorString(err) != "hello.md: invalid image: expected a string, got [a b]" {
+		t.Errorf("got %v; want an invalid image error", err)
+	}
+}
+
+func TestFrontmatterFormats(t *testing.T) {
+	sources := map[string]string{
+		"yaml": "---\ntitle: Hello\ndate: 2017-01-02\ntags: [go, blog]\nmenu_weight: 3\nseries:\n  name: Intro\n---\nHello.\n",
+		"toml": "+++\ntitle = \"Hello\"\ndate = 2017-01-02\ntags = [\"go\", \"blog\"]\nmenu_weight = 3\n\n[series]\nname = \"Intro\"\n+++\nHello.\n",
+		"json": "{\n  \"title\": \"Hello\",\n  \"date\": \"2017-01-02\",\n  \"tags\": [\"go\", \"blog\"],\n  \"menu_weight\": 3,\n  \"series\": {\"name\": \"Intro\"}\n}\nHello.\n",
+	}
+	posts := make(map[string]*Post)
+	for format, text := range sources {
+		post := &Post{Index: &Index{config: defaultConfig()}}
+		if err := post.Read(context.Background(), "hello.md", []byte(text)); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		posts[format] = post
+	}
+
+	want := posts["yaml"]
+	if want.Title != "Hello" || want.MenuWeight != 3 || !reflect.DeepEqual(want.Tags, []string{"go", "blog"}) {
+		t.Fatalf("got YAML post %+v; want its frontmatter", want)
+	}
+	for _, format := range []string{"toml", "json"} {
+		got := posts[format]
+		if got.Title != want.Title || !got.Date.Equal(want.Date) || !reflect.DeepEqual(got.Tags, want.Tags) || got.MenuWeight != want.MenuWeight || string(got.Body) != string(want.Body) {
+			t.Errorf("%s: got post %+v; want %+v", format, got, want)
+		}
+		if !reflect.DeepEqual(got.Params, want.Params) {
+			t.Errorf("%s: got params %#v; want %#v", format, got.Params, want.Params)
+		}
+	}
+}
+
+func TestFrontmatterDelimiters(t *testing.T) {
+	for text, want := range map[string]string{
+		"":                                 "post.md: missing frontmatter delimiter",
+		"# Just markdown\n":                "post.md: missing frontmatter delimiter",
+		"---\ntitle: t\n\nNo closing.\n":   "post.md: missing closing frontmatter delimiter",
+		"---\ntitle: t\n---":               "",
+		"---\r\ntitle: t\r\n---\r\nBody\n": "",
+	} {
+		p := &Post{Index: &Index{}}
+		if err := p.Read(context.Background(), "post.md", []byte(text)); errorString(err) != want {
+			t.Errorf("for %q got %v; want %q", text, err, want)
+		}
+	}
 }
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type canonicalHostHandler struct {
+	scheme string
+	host   string
+	h      http.Handler
+}
+
+func (c *canonicalHostHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	scheme := "http"
+	if r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
+		scheme = "https"
+	}
+	target := scheme
+	if c.scheme != "" {
+		target = c.scheme
+	}
+	if strings.EqualFold(r.Host, c.host) && target == scheme {
+		c.h.ServeHTTP(w, r)
+		return
+	}
+	logger.Info(r.Method, r.URL.String(), "redirected to", c.host)
+	http.Redirect(w, r, target+"://"+c.host+r.URL.RequestURI(), http.StatusMovedPermanently)
+}
+
+// CanonicalHostHandler redirects requests for other hosts to canonical, a
+// host or a URL like https://example.com to also redirect to its scheme.
+// Requests for canonical are served by h.
+func CanonicalHostHandler(canonical string, h http.Handler) (http.Handler, error) {
+	c := &canonicalHostHandler{host: canonical, h: h}
+	if strings.Contains(canonical, "://") {
+		u, err := url.Parse(canonical)
+		if err != nil {
+			return nil, err
+		}
+		c.scheme, c.host = u.Scheme, u.Host
+	}
+	return c, nil
+}
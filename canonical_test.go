@@ -0,0 +1,45 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCanonicalHost(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, test := range []struct {
+		canonical string
+		url       string
+		https     bool
+		location  string
+	}{
+		{"www.example.com", "http://example.com/post/hello?x=1", false, "http://www.example.com/post/hello?x=1"},
+		{"www.example.com", "https://example.com/", true, "https://www.example.com/"},
+		{"www.example.com", "http://www.example.com/", false, ""},
+		{"https://example.com", "http://example.com/index.xml", false, "https://example.com/index.xml"},
+		{"https://example.com", "https://www.example.com/", true, "https://example.com/"},
+		{"https://example.com", "https://example.com/", true, ""},
+	} {
+		h, err := CanonicalHostHandler(test.canonical, ok)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest("GET", test.url, nil)
+		if test.https {
+			r.TLS = &tls.ConnectionState{}
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if test.location == "" {
+			if w.Code != http.StatusOK {
+				t.Errorf("%s for %s: got status %d; want it served", test.url, test.canonical, w.Code)
+			}
+			continue
+		}
+		if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != test.location {
+			t.Errorf("%s for %s: got %d to %q; want %d to %q", test.url, test.canonical, w.Code, w.Header().Get("Location"), http.StatusMovedPermanently, test.location)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// cleanOutput removes the contents of the output of config, keeping the
+// directory itself. With dryRun it only logs what it would remove. It refuses
+// to clean an output holding the source, assets, templates or data.
+func cleanOutput(config *Config, dryRun bool) error {
+	// previews of other branches live next to this one
+	outputPath := path.Join(config.OutputPath, config.Subdir)
+	output, err := filepath.Abs(outputPath)
+	if err != nil {
+		return err
+	}
+	for _, p := range []string{config.SourcePath, config.AssetsPath, config.TemplatesPath, config.DataPath} {
+		if p == "" {
+			continue
+		}
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return err
+		}
+		if abs == output || strings.HasPrefix(abs, output+string(filepath.Separator)) {
+			return fmt.Errorf("refusing to clean %s, it contains %s", outputPath, p)
+		}
+	}
+
+	entries, err := ioutil.ReadDir(outputPath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		// removing the lock would let another blgo lock a new one meanwhile
+		if entry.Name() == lockFilename {
+			continue
+		}
+		filename := path.Join(outputPath, entry.Name())
+		if dryRun {
+			logger.Info("would remove", filename)
+			continue
+		}
+		logger.Info("removing", filename)
+		if err := os.RemoveAll(filename); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"runtime"
+	"testing"
+)
+
+func TestCleanOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"hello.md": "---\ntitle: Hello\n---\nHello.\n",
+	})
+	stale := path.Join(config.OutputPath, config.PostsDir, "renamed.html")
+	if err := os.MkdirAll(path.Dir(stale), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(stale, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cleanOutput(config, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(stale); err != nil {
+		t.Errorf("dry run removed %s: %v", stale, err)
+	}
+	if err := cleanOutput(config, false); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := ioutil.ReadDir(config.OutputPath)
+	if err != nil {
+		t.Fatalf("got %v; want the output directory kept", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("got %d entries left in the output; want none", len(entries))
+	}
+
+	for _, output := range []string{config.SourcePath, dir} {
+		unsafe := *config
+		unsafe.OutputPath = output
+		if err := cleanOutput(&unsafe, false); err == nil {
+			t.Errorf("cleaning %s: got no error; want a refusal", output)
+		}
+	}
+	if _, err := os.Stat(path.Join(config.SourcePath, "hello.md")); err != nil {
+		t.Errorf("source removed: %v", err)
+	}
+}
+
+func TestCleanOutputKeepsLock(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no output lock on Windows")
+	}
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, nil)
+	release, err := acquireLock(config.OutputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	if err := ioutil.WriteFile(path.Join(config.OutputPath, "index.html"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cleanOutput(config, false); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := ioutil.ReadDir(config.OutputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != lockFilename {
+		t.Errorf("got %d entries left in the output; want only %s", len(entries), lockFilename)
+	}
+	if _, err := acquireLock(config.OutputPath); err == nil {
+		t.Error("got the lock after cleaning; want it still held")
+	}
+}
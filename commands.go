@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// commands are the subcommands run instead of building, e.g. "blgo render -"
+var commands = map[string]func(args []string, stdin io.Reader, stdout io.Writer) error{
+	"render": renderCommand,
+	"export": exportCommand,
+	"list":   listCommand,
+}
+
+// readSource reads the settings and the posts of a source directory
+func readSource(sourcePath string) (*Index, error) {
+	index := &Index{config: defaultConfig()}
+	if err := index.ReadFrontmatterFile(path.Join(sourcePath, settingsFilename)); err != nil {
+		return nil, err
+	}
+	files, err := listSourceFiles(sourcePath, index.settings().sourceExts())
+	if err != nil {
+		return nil, err
+	}
+	if index.Posts, err = readPosts(context.Background(), index, sourcePath, files); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// renderCommand renders a single post with the post template. The post is
+// read from stdin when the filename is "-".
+func renderCommand(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("render", flag.ContinueOnError)
+	templatesFlag := flags.String("templates", "", "path to the templates directory")
+	settingsFlag := flags.String("settings", "", "path to the settings file, e.g. src/"+settingsFilename)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: blgo render [options] filename|-")
+	}
+
+	var body []byte
+	var err error
+	filename := flags.Arg(0)
+	if filename == "-" {
+		filename = "stdin.md"
+		body, err = ioutil.ReadAll(stdin)
+	} else {
+		body, err = ioutil.ReadFile(filename)
+	}
+	if err != nil {
+		return err
+	}
+
+	index := &Index{config: defaultConfig()}
+	if *settingsFlag != "" {
+		if err := index.ReadFrontmatterFile(*settingsFlag); err != nil {
+			return err
+		}
+	}
+	post := &Post{Index: index}
+	if err := post.Read(context.Background(), filename, body); err != nil {
+		return err
+	}
+
+	tmpl, err := parseHTMLTemplates(template.New("").Funcs(template.FuncMap(templateFuncs(index.assetsURL(), nil))), path.Join(*templatesFlag, postTmplFilename))
+	if err != nil {
+		return err
+	}
+	return tmpl.ExecuteTemplate(stdout, postTmplFilename, post)
+}
+
+// exportedPost is a post in the output of the export command
+type exportedPost struct {
+	Slug    string   `json:"slug"`
+	Title   string   `json:"title"`
+	Date    string   `json:"date"`
+	Updated string   `json:"updated"`
+	Link    string   `json:"link"`
+	Tags    []string `json:"tags"`
+	Body    string   `json:"body"`
+}
+
+// exportCommand writes the published posts of a source directory as JSON,
+// oldest first, e.g. for syncing them to another system
+func exportCommand(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	sinceFlag := flags.String("since", "", "only export posts published or updated on or after this date, in any format of the post dates, e.g. 2024-01-01")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: blgo export [options] source")
+	}
+
+	index, err := readSource(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	// -since is a date like those of the posts
+	var since time.Time
+	if *sinceFlag != "" {
+		if since, err = parseDate(*sinceFlag, index.dateFormats()); err != nil {
+			return fmt.Errorf("invalid -since: %v", err)
+		}
+	}
+	index = index.filter(func(post *Post) bool {
+		return !post.Draft && (!post.Date.Before(since) || !post.Updated.Before(since))
+	})
+	sort.Stable(index)
+
+	posts := make([]exportedPost, 0, len(index.Posts))
+	for _, post := range index.Posts {
+		posts = append(posts, exportedPost{
+			Slug:    post.Slug,
+			Title:   post.Title,
+			Date:    post.Date.Format(shortTimeFormat),
+			Updated: post.Updated.Format(shortTimeFormat),
+			Link:    post.Link,
+			Tags:    post.Tags,
+			Body:    string(post.Body),
+		})
+	}
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(posts)
+}
+
+// listedPost is a post in the output of the list command
+type listedPost struct {
+	Slug  string   `json:"slug"`
+	Date  string   `json:"date"`
+	Draft bool     `json:"draft"`
+	Tags  []string `json:"tags"`
+	Words int      `json:"words"`
+}
+
+// listCommand prints the posts of a source directory and their metadata,
+// newest first, without building them
+func listCommand(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	jsonFlag := flags.Bool("json", false, "print JSON instead of a table")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: blgo list [options] source")
+	}
+
+	index, err := readSource(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	sort.Stable(sort.Reverse(index))
+
+	posts := make([]listedPost, 0, len(index.Posts))
+	for _, post := range index.Posts {
+		posts = append(posts, listedPost{
+			Slug:  post.Slug,
+			Date:  post.Date.Format(shortTimeFormat),
+			Draft: post.Draft,
+			Tags:  post.Tags,
+			Words: post.WordCount,
+		})
+	}
+	if *jsonFlag {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(posts)
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "SLUG\tDATE\tDRAFT\tTAGS\tWORDS")
+	for _, post := range posts {
+		fmt.Fprintf(w, "%s\t%s\t%v\t%s\t%d\n", post.Slug, post.Date, post.Draft, strings.Join(post.Tags, ","), post.Words)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRenderCommand(t *testing.T) {
+	stdin := strings.NewReader("---\ntitle: Piped post\n---\nHello **world**.\n")
+	var stdout bytes.Buffer
+	args := []string{
+		"-templates", path.Join("example", "templates"),
+		"-settings", path.Join("example", "src", settingsFilename),
+		"-",
+	}
+	if err := renderCommand(args, stdin, &stdout); err != nil {
+		t.Fatal(err)
+	}
+	got := stdout.String()
+	for _, want := range []string{
+		`<h1 class="entry-title" itemprop="headline">Piped post</h1>`,
+		"<p>Hello <strong>world</strong>.</p>",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got %q; want it to contain %q", got, want)
+		}
+	}
+}
+
+func TestExportCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"old.md":     "---\ntitle: Old\ndate: 2023-12-31\n---\nOld.\n",
+		"revised.md": "---\ntitle: Revised\ndate: 2023-06-01\nupdated: 2024-03-01\n---\nRevised.\n",
+		"new.md":     "---\ntitle: New\ndate: 2024-01-02\nupdated: 2024-02-01\ntags: [go, blgo]\n---\nNew.\n",
+		"edge.md":    "---\ntitle: Edge\ndate: 2024-01-01\n---\nEdge.\n",
+		"draft.md":   "---\ntitle: Draft\ndate: 2024-01-03\ndraft: true\n---\nDraft.\n",
+	})
+	var stdout bytes.Buffer
+	if err := exportCommand([]string{"-since", "2024-01-01", config.SourcePath}, nil, &stdout); err != nil {
+		t.Fatal(err)
+	}
+	var got []exportedPost
+	if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []exportedPost{
+		{Slug: "revised", Title: "Revised", Date: "2023-06-01", Updated: "2024-03-01", Link: "https://example.com/post/revised", Body: "<p>Revised.</p>\n"},
+		{Slug: "edge", Title: "Edge", Date: "2024-01-01", Updated: "2024-01-01", Link: "https://example.com/post/edge", Body: "<p>Edge.</p>\n"},
+		{Slug: "new", Title: "New", Date: "2024-01-02", Updated: "2024-02-01", Link: "https://example.com/post/new", Tags: []string{"go", "blgo"}, Body: "<p>New.</p>\n"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v; want %+v", got, want)
+	}
+
+	// -since takes the date formats of frontmatter
+	stdout.Reset()
+	if err := exportCommand([]string{"-since", "2024-01-01T12:00:00Z", config.SourcePath}, nil, &stdout); err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if want := []exportedPost{want[0], want[2]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v; want %+v", got, want)
+	}
+
+	if err := exportCommand([]string{"-since", "yesterday", config.SourcePath}, nil, &stdout); err == nil || !strings.HasPrefix(err.Error(), "invalid -since: ") {
+		t.Errorf("got %v; want an invalid -since error", err)
+	}
+}
+
+func TestListCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"hello.md": "---\ntitle: Hello\ndate: 2017-01-01\ntags: [go]\n---\nHello there, world.\n",
+		"draft.md": "---\ntitle: Draft\ndate: 2017-01-02\ndraft: true\n---\nSoon.\n",
+	})
+
+	var stdout bytes.Buffer
+	if err := listCommand([]string{"-json", config.SourcePath}, nil, &stdout); err != nil {
+		t.Fatal(err)
+	}
+	var got []listedPost
+	if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []listedPost{
+		{Slug: "draft", Date: "2017-01-02", Draft: true, Words: 1},
+		{Slug: "hello", Date: "2017-01-01", Tags: []string{"go"}, Words: 3},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v; want %+v", got, want)
+	}
+
+	stdout.Reset()
+	if err := listCommand([]string{config.SourcePath}, nil, &stdout); err != nil {
+		t.Fatal(err)
+	}
+	wantTable := "SLUG   DATE        DRAFT  TAGS  WORDS\n" +
+		"draft  2017-01-02  true         1\n" +
+		"hello  2017-01-01  false  go    3\n"
+	if stdout.String() != wantTable {
+		t.Errorf("got %q; want %q", stdout.String(), wantTable)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// configFilename is the config file read by default, if it exists
+const configFilename = "blgo.yaml"
+
+// applyConfigFile sets the flags of fs that weren't given on the command line
+// from the YAML file filename. Its keys are the flag names and "source", the
+// sources path, which is returned. A missing file is only an error if
+// required.
+func applyConfigFile(fs *flag.FlagSet, filename string, required bool) (source string, err error) {
+	body, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) && !required {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	values := make(map[string]interface{})
+	if err := yaml.Unmarshal(body, &values); err != nil {
+		return "", fmt.Errorf("%s: %v", filename, err)
+	}
+
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := configValue(values[key])
+		switch {
+		case key == "source":
+			source = value
+		case key == "config" || fs.Lookup(key) == nil:
+			return "", fmt.Errorf("%s: unknown key %q", filename, key)
+		case given[key]:
+			// the command line wins
+		default:
+			if err := fs.Set(key, value); err != nil {
+				return "", fmt.Errorf("%s: invalid %s: %v", filename, key, err)
+			}
+		}
+	}
+	return source, nil
+}
+
+// configValue formats a value of the config file like it is given on the
+// command line, lists are comma-separated
+func configValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = fmt.Sprint(item)
+		}
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
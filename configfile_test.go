@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestApplyConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := path.Join(dir, configFilename)
+	text := "templates: theme\noutput: public\nassets: static\nwatch: true\nsource: posts\nexcerpt: [more, paragraph]\n"
+	if err := ioutil.WriteFile(filename, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := flag.NewFlagSet("blgo", flag.ContinueOnError)
+	templates := fs.String("templates", "", "")
+	output := fs.String("output", "generated", "")
+	assets := fs.String("assets", "", "")
+	serve := fs.String("serve", "", "")
+	watch := fs.Bool("watch", false, "")
+	excerpt := stringsFlag(defaultConfig().Excerpt)
+	fs.Var(&excerpt, "excerpt", "")
+	if err := fs.Parse([]string{"-output", "dist"}); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := applyConfigFile(fs, filename, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct{ name, got, want string }{
+		{"source", source, "posts"},
+		{"templates", *templates, "theme"},
+		{"output", *output, "dist"},
+		{"assets", *assets, "static"},
+		{"serve", *serve, ""},
+		{"excerpt", excerpt.String(), "more,paragraph"},
+	} {
+		if c.got != c.want {
+			t.Errorf("got %s %q; want %q", c.name, c.got, c.want)
+		}
+	}
+	if !*watch {
+		t.Error("got watch false; want true from the file")
+	}
+
+	if _, err := applyConfigFile(fs, path.Join(dir, "missing.yaml"), false); err != nil {
+		t.Errorf("got %v; want a missing default file to be ignored", err)
+	}
+	if _, err := applyConfigFile(fs, path.Join(dir, "missing.yaml"), true); err == nil {
+		t.Error("got no error for a missing -config file")
+	}
+	for text, want := range map[string]string{
+		"ouptut: public\n": `unknown key "ouptut"`,
+		"watch: maybe\n":   "invalid watch",
+	} {
+		if err := ioutil.WriteFile(filename, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		fs := flag.NewFlagSet("blgo", flag.ContinueOnError)
+		fs.Bool("watch", false, "")
+		if _, err := applyConfigFile(fs, filename, true); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("for %q got %v; want an error containing %q", text, err, want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// readData reads the YAML and JSON files in dir into a map by filename without
+// the extension, e.g. data/nav.yaml is "nav". A missing dir has no data.
+func readData(dir string) (map[string]interface{}, error) {
+	data := make(map[string]interface{})
+	if dir == "" {
+		return data, nil
+	}
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		ext := filepath.Ext(file.Name())
+		if file.IsDir() || ext != ".yaml" && ext != ".yml" && ext != ".json" {
+			continue
+		}
+		filename := path.Join(dir, file.Name())
+		name := strings.TrimSuffix(file.Name(), ext)
+		if _, ok := data[name]; ok {
+			return nil, fmt.Errorf("%s: more than one data file named %q", filename, name)
+		}
+		body, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		var v interface{}
+		if ext == ".json" {
+			err = json.Unmarshal(body, &v)
+		} else {
+			err = yaml.Unmarshal(body, &v)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		data[name] = stringKeys(v)
+	}
+	return data, nil
+}
+
+// stringKeys converts the maps yaml decodes to maps with string keys, which
+// templates can access by field name, e.g. .Site.Data.nav.title
+func stringKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = stringKeys(value)
+		}
+		return m
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = stringKeys(value)
+		}
+		return v
+	case []interface{}:
+		for i, value := range v {
+			v[i] = stringKeys(value)
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestSiteData(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, nil)
+	config.DataPath = path.Join(dir, "data")
+	for name, text := range map[string]string{
+		"nav.yaml":      "- title: Home\n  url: /\n- title: About\n  url: /about\n",
+		"projects.json": `{"blgo": {"stars": 42}}`,
+		"notes.txt":     "not data",
+	} {
+		if err := os.MkdirAll(config.DataPath, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path.Join(config.DataPath, name), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tmpl := `{{range .Site.Data.nav}}<a href="{{.url}}">{{.title}}</a>{{end}} {{.Site.Data.projects.blgo.stars}}`
+	if err := ioutil.WriteFile(path.Join(config.TemplatesPath, indexTmplFilename), []byte(tmpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buildAll(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(path.Join(config.OutputPath, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<a href="/">Home</a><a href="/about">About</a> 42`; string(got) != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+
+	if err := ioutil.WriteFile(path.Join(config.DataPath, "nav.json"), []byte("[]"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buildAll(context.Background(), config); err == nil || !strings.Contains(err.Error(), `more than one data file named "nav"`) {
+		t.Errorf("got %v; want a duplicate data file error", err)
+	}
+
+	if data, err := readData(path.Join(dir, "missing")); err != nil || len(data) != 0 {
+		t.Errorf("got %v, %v; want no data for a missing directory", data, err)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// dateFormats are the layouts of the dates in frontmatter, tried in order,
+// unless the settings give a dateformat
+var dateFormats = []string{
+	shortTimeFormat,
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"Jan 2, 2006",
+	"January 2, 2006",
+}
+
+// parseDate parses s in the first of formats it matches
+func parseDate(s string, formats []string) (time.Time, error) {
+	for _, format := range formats {
+		if t, err := time.Parse(format, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("parsing time %q: expected one of the formats %s", s, strings.Join(formats, ", "))
+}
+
+// dateFormats returns the layouts of the dates of posts
+func (index *Index) dateFormats() []string {
+	if index.dateFormat != "" {
+		return []string{index.dateFormat}
+	}
+	return dateFormats
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDateFormats(t *testing.T) {
+	for date, want := range map[string]time.Time{
+		"2023-01-02":           time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC),
+		"2023-01-02T15:04:05Z": time.Date(2023, 1, 2, 15, 4, 5, 0, time.UTC),
+		"2023-01-02 15:04":     time.Date(2023, 1, 2, 15, 4, 0, 0, time.UTC),
+		"Jan 2, 2023":          time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC),
+		"January 2, 2023":      time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC),
+	} {
+		post := &Post{Index: &Index{}}
+		if err := post.Read(context.Background(), "x.md", []byte("---\ntitle: X\ndate: "+date+"\n---\nX.\n")); err != nil {
+			t.Errorf("for %q got error %v", date, err)
+		} else if !post.Date.Equal(want) {
+			t.Errorf("for %q got %v; want %v", date, post.Date, want)
+		}
+	}
+
+	post := &Post{Index: &Index{}}
+	err := post.Read(context.Background(), "x.md", []byte("---\ntitle: X\ndate: 02/01/2023\n---\nX.\n"))
+	if got := errorString(err); !strings.HasPrefix(got, `x.md: parsing time "02/01/2023": expected one of the formats 2006-01-02, `) {
+		t.Errorf("got error %q; want the formats tried", got)
+	}
+
+	// a dateformat setting replaces the formats
+	index := &Index{}
+	if err := index.ReadFrontmatter([]byte(strings.Replace(testSettings, "---\n", "---\ndateformat: 02/01/2006\n", 1))); err != nil {
+		t.Fatal(err)
+	}
+	post = &Post{Index: index}
+	if err := post.Read(context.Background(), "x.md", []byte("---\ntitle: X\ndate: 02/01/2023\n---\nX.\n")); err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC); !post.Date.Equal(want) {
+		t.Errorf("got %v; want %v", post.Date, want)
+	}
+	err = post.Read(context.Background(), "x.md", []byte("---\ntitle: X\ndate: 2023-01-02\n---\nX.\n"))
+	if want := `x.md: parsing time "2023-01-02": expected one of the formats 02/01/2006`; errorString(err) != want {
+		t.Errorf("got error %q; want %q", errorString(err), want)
+	}
+}
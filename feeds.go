@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// feedFormat is a feed the build can generate from a template
+type feedFormat struct {
+	Template string
+	Output   string
+	// XML feeds are checked to be UTF-8 and get an XML declaration
+	XML bool
+	// Write writes the feeds built without a template
+	Write func(filename string, index *Index) error
+	// ContentType is the type the feed is served with
+	ContentType string
+}
+
+// feedFormats are the feeds selectable with Config.Feeds by name
+var feedFormats = map[string]feedFormat{
+	"rss":     {Template: feedTmplFilename, Output: "index.xml", XML: true, ContentType: "application/rss+xml"},
+	"atom":    {Template: "atom.tmpl.xml", Output: "atom.xml", XML: true, ContentType: "application/atom+xml"},
+	"json":    {Output: jsonFeedFilename, Write: writeJSONFeed, ContentType: "application/feed+json"},
+	"podcast": {Template: "podcast.tmpl.xml", Output: "podcast.xml", XML: true, ContentType: "application/rss+xml"},
+}
+
+// feeds returns the formats of the selected feeds
+func (config *Config) feeds() ([]feedFormat, error) {
+	feeds := make([]feedFormat, 0, len(config.Feeds))
+	for _, name := range config.Feeds {
+		feed, ok := feedFormats[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown feed %q", name)
+		}
+		feeds = append(feeds, feed)
+	}
+	return feeds, nil
+}
+
+// FeedLink returns the absolute URL of the named file of the blog, e.g. a
+// feed, whether or not its URL ends with a slash
+func (index *Index) FeedLink(name string) string {
+	return strings.TrimSuffix(index.URL, "/") + "/" + name
+}
+
+// writeFeeds writes the selected feeds of index and returns their names
+func writeFeeds(tmpl templateSet, outputPath string, feeds []feedFormat, index *Index) ([]string, error) {
+	generated := make([]string, 0, len(feeds))
+	for _, feed := range feeds {
+		filename := path.Join(outputPath, feed.Output)
+		var err error
+		if feed.Write != nil {
+			err = feed.Write(filename, index)
+		} else if feed.XML {
+			err = executeFeedFile(tmpl, filename, feed.Template, index)
+		} else {
+			err = executeTemplateFile(tmpl, filename, feed.Template, index)
+		}
+		if err != nil {
+			return nil, err
+		}
+		generated = append(generated, feed.Output)
+	}
+	return generated, nil
+}
+
+const jsonFeedFilename = "feed.json"
+
+// jsonFeed is a feed in the JSON Feed 1.1 format, https://jsonfeed.org/version/1.1
+type jsonFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url,omitempty"`
+	FeedURL     string           `json:"feed_url,omitempty"`
+	Authors     []jsonFeedAuthor `json:"authors,omitempty"`
+	Items       []jsonFeedItem   `json:"items"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url,omitempty"`
+	Title         string           `json:"title,omitempty"`
+	ContentHTML   string           `json:"content_html"`
+	Summary       string           `json:"summary,omitempty"`
+	DatePublished time.Time        `json:"date_published"`
+	DateModified  time.Time        `json:"date_modified"`
+	Authors       []jsonFeedAuthor `json:"authors,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+}
+
+// jsonFeedAuthors returns author as the authors of a JSON feed, none if nil
+func jsonFeedAuthors(author *Author) []jsonFeedAuthor {
+	if author == nil || author.Name == "" {
+		return nil
+	}
+	return []jsonFeedAuthor{{Name: author.Name}}
+}
+
+// writeJSONFeed writes the published posts of index as a JSON feed
+func writeJSONFeed(filename string, index *Index) error {
+	feed := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       index.Title,
+		HomePageURL: index.URL,
+		FeedURL:     strings.TrimSuffix(index.URL, "/") + "/" + jsonFeedFilename,
+		Authors:     jsonFeedAuthors(index.Author),
+		Items:       []jsonFeedItem{},
+	}
+	for _, post := range index.Posts {
+		if post.Draft {
+			continue
+		}
+		feed.Items = append(feed.Items, jsonFeedItem{
+			ID:            post.GUID,
+			URL:           post.Canonical,
+			Title:         post.Title,
+			ContentHTML:   post.FeedBody,
+			Summary:       post.Description,
+			DatePublished: post.FeedDate,
+			DateModified:  post.Updated,
+			Authors:       jsonFeedAuthors(post.Author),
+			Tags:          post.Tags,
+		})
+	}
+	data, err := json.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, func(w io.Writer) error {
+		_, err := w.Write(append(data, '\n'))
+		return err
+	})
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFeedsSelection(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"hello.md": "---\ntitle: Hello \"you\"\ndate: 2017-01-02\ntags: [go, blgo]\n---\nHello.\n",
+	})
+	tmpl, err := ioutil.ReadFile(path.Join("example", "templates", feedFormats["atom"].Template))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(config.TemplatesPath, feedFormats["atom"].Template), tmpl, 0644); err != nil {
+		t.Fatal(err)
+	}
+	config.Feeds = []string{"atom", "json"}
+	generated, err := buildAll(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	atom, err := ioutil.ReadFile(path.Join(config.OutputPath, "atom.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries struct {
+		Entries []struct {
+			Title string `xml:"title"`
+			ID    string `xml:"id"`
+			Link  struct {
+				Href string `xml:"href,attr"`
+				Rel  string `xml:"rel,attr"`
+			} `xml:"link"`
+			Categories []struct {
+				Term string `xml:"term,attr"`
+			} `xml:"category"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(atom, &entries); err != nil || len(entries.Entries) != 1 {
+		t.Fatalf("got atom.xml %q (%v); want a valid feed with one entry", atom, err)
+	}
+	entry := entries.Entries[0]
+	if entry.ID != "https://example.com/post/hello" || entry.Link.Href != entry.ID || entry.Link.Rel != "alternate" || len(entry.Categories) != 2 || entry.Categories[1].Term != "blgo" {
+		t.Errorf("got entry %+v; want its id, alternate link and categories", entry)
+	}
+
+	feed, err := ioutil.ReadFile(path.Join(config.OutputPath, "feed.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var items struct {
+		Items []struct {
+			Title string `json:"title"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(feed, &items); err != nil || len(items.Items) != 1 || items.Items[0].Title != `Hello "you"` {
+		t.Errorf("got feed.json %q (%v); want a valid feed with one item", feed, err)
+	}
+
+	for _, name := range []string{"index.xml", "podcast.xml"} {
+		if _, err := os.Stat(path.Join(config.OutputPath, name)); !os.IsNotExist(err) {
+			t.Errorf("got %v; want no %s", err, name)
+		}
+	}
+	if got := strings.Join(generated, " "); !strings.Contains(got, "atom.xml feed.json") {
+		t.Errorf("got generated %q; want the selected feeds", got)
+	}
+
+	config.Feeds = []string{"rss", "gopher"}
+	if _, err := buildAll(context.Background(), config); err == nil || !strings.Contains(err.Error(), `unknown feed "gopher"`) {
+		t.Errorf("got %v; want an unknown feed error", err)
+	}
+}
+
+func TestAtomFeedLinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		settingsFilename: strings.Replace(testSettings, "url: https://example.com/\n", "url: https://example.com\n", 1),
+		"hello.md":       "---\ntitle: Hello\ndate: 2017-01-02\n---\nHello.\n",
+	})
+	tmpl, err := ioutil.ReadFile(path.Join("example", "templates", feedFormats["atom"].Template))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(config.TemplatesPath, feedFormats["atom"].Template), tmpl, 0644); err != nil {
+		t.Fatal(err)
+	}
+	config.Feeds = []string{"atom"}
+	if _, err := buildAll(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	atom, err := ioutil.ReadFile(path.Join(config.OutputPath, "atom.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var feed struct {
+		ID    string `xml:"id"`
+		Links []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+	}
+	if err := xml.Unmarshal(atom, &feed); err != nil {
+		t.Fatal(err)
+	}
+	if feed.ID != "https://example.com/" {
+		t.Errorf("got id %q; want %q", feed.ID, "https://example.com/")
+	}
+	var self string
+	for _, link := range feed.Links {
+		if link.Rel == "self" {
+			self = link.Href
+		}
+	}
+	if self != "https://example.com/atom.xml" {
+		t.Errorf("got self link %q; want %q", self, "https://example.com/atom.xml")
+	}
+}
+
+func TestJSONFeed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	index := &Index{Title: "Test", URL: "https://example.com/", Author: &Author{Name: "Gopher"}}
+	for name, text := range map[string]string{
+		"hello.md": "---\ntitle: Hello\ndate: 2017-01-02\nupdated: 2017-02-03\ntags: [go]\n---\nHello.\n",
+		"draft.md": "---\ntitle: Draft\ndate: 2017-01-03\ndraft: true\n---\nDraft.\n",
+	} {
+		post := &Post{Index: index}
+		if err := post.Read(context.Background(), name, []byte(text)); err != nil {
+			t.Fatal(err)
+		}
+		index.Posts = append(index.Posts, post)
+	}
+	filename := path.Join(dir, "feed.json")
+	if err := writeJSONFeed(filename, index); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got jsonFeed
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       "Test",
+		HomePageURL: "https://example.com/",
+		FeedURL:     "https://example.com/feed.json",
+		Authors:     []jsonFeedAuthor{{Name: "Gopher"}},
+		Items: []jsonFeedItem{{
+			ID:            "https://example.com/post/hello",
+			URL:           "https://example.com/post/hello",
+			Title:         "Hello",
+			ContentHTML:   "<p>Hello.</p>\n",
+			DatePublished: time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC),
+			DateModified:  time.Date(2017, 2, 3, 0, 0, 0, 0, time.UTC),
+			Authors:       []jsonFeedAuthor{{Name: "Gopher"}},
+			Tags:          []string{"go"},
+		}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v; want %+v", got, want)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+type gzipHandler struct {
+	dir string
+	h   http.Handler
+}
+
+func (g *gzipHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := path.Clean("/" + r.URL.Path)
+	f, err := os.Open(path.Join(g.dir, name+".gz"))
+	if err != nil || strings.HasSuffix(r.URL.Path, "/") {
+		if f != nil {
+			f.Close()
+		}
+		g.h.ServeHTTP(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		g.h.ServeHTTP(w, r)
+		return
+	}
+
+	// caches must keep the variants apart
+	w.Header().Add("Vary", "Accept-Encoding")
+	if !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+		g.h.ServeHTTP(w, r)
+		return
+	}
+	// the type is the plain file's, not sniffed from the compressed bytes,
+	// unless already set like http.FileServer does
+	if w.Header().Get("Content-Type") == "" {
+		contentType := mime.TypeByExtension(path.Ext(name))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.Header().Set("Content-Encoding", "gzip")
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip
+func acceptsGzip(header string) bool {
+	for _, coding := range strings.Split(header, ",") {
+		params := strings.Split(coding, ";")
+		if name := strings.TrimSpace(params[0]); name != "gzip" && name != "*" {
+			continue
+		}
+		accepted := true
+		for _, param := range params[1:] {
+			if q := strings.TrimSpace(param); strings.HasPrefix(q, "q=") {
+				weight, err := strconv.ParseFloat(q[2:], 64)
+				accepted = err == nil && weight > 0
+			}
+		}
+		return accepted
+	}
+	return false
+}
+
+// GzipHandler serves the precompressed name.gz in dir in place of name to
+// clients accepting gzip, other requests are served by h
+func GzipHandler(dir string, h http.Handler) http.Handler {
+	return &gzipHandler{dir: dir, h: h}
+}
+
+// gzipMinSize is the size of the smallest responses worth compressing
+const gzipMinSize = 1024
+
+type compressHandler struct {
+	h http.Handler
+}
+
+func (c *compressHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// ranges are of the uncompressed bytes
+	if r.Method == http.MethodHead || r.Header.Get("Range") != "" || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+		c.h.ServeHTTP(w, r)
+		return
+	}
+	cw := &compressWriter{ResponseWriter: w}
+	c.h.ServeHTTP(cw, r)
+	cw.Close()
+}
+
+// CompressHandler compresses the responses of h with gzip for clients
+// accepting it. Small responses, those of types already compressed, e.g.
+// images, and those already encoded, e.g. precompressed files, are sent as
+// they are.
+func CompressHandler(h http.Handler) http.Handler {
+	return &compressHandler{h: h}
+}
+
+// compressWriter holds back the start of a response until it knows whether
+// it is worth compressing
+type compressWriter struct {
+	http.ResponseWriter
+	status  int
+	buf     []byte
+	started bool
+	zw      *gzip.Writer
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.status == 0 {
+		cw.status = status
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if cw.started {
+		if cw.zw != nil {
+			return cw.zw.Write(b)
+		}
+		return cw.ResponseWriter.Write(b)
+	}
+	cw.buf = append(cw.buf, b...)
+	if len(cw.buf) >= gzipMinSize {
+		if err := cw.start(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// start writes the header, deciding on the compression, and the bytes held
+// back so far
+func (cw *compressWriter) start() error {
+	cw.started = true
+	header := cw.Header()
+	if cw.status == http.StatusOK && len(cw.buf) >= gzipMinSize && header.Get("Content-Encoding") == "" && compressible(header.Get("Content-Type")) {
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", "gzip")
+		header.Add("Vary", "Accept-Encoding")
+		cw.zw = gzip.NewWriter(cw.ResponseWriter)
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+	buf := cw.buf
+	cw.buf = nil
+	if cw.zw != nil {
+		_, err := cw.zw.Write(buf)
+		return err
+	}
+	_, err := cw.ResponseWriter.Write(buf)
+	return err
+}
+
+// Close ends the response, sending what is held back
+func (cw *compressWriter) Close() error {
+	if cw.status == 0 {
+		return nil
+	}
+	if !cw.started {
+		if err := cw.start(); err != nil {
+			return err
+		}
+	}
+	if cw.zw != nil {
+		return cw.zw.Close()
+	}
+	return nil
+}
+
+// compressible reports whether responses of contentType shrink with gzip,
+// unlike e.g. images and archives
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "json") ||
+		strings.HasSuffix(mediaType, "xml") ||
+		mediaType == "application/javascript"
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestGzipPrecompressed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, nil)
+	page := []byte("<p>Hello</p>")
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write(page)
+	zw.Close()
+	for name, data := range map[string][]byte{"post/hello.html": page, "post/hello.html.gz": compressed.Bytes()} {
+		if err := ioutil.WriteFile(path.Join(config.OutputPath, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mux := serveMux(config, "")
+
+	for _, test := range []struct {
+		accept   string
+		encoding string
+		body     []byte
+	}{
+		{"gzip, deflate", "gzip", compressed.Bytes()},
+		{"br;q=1.0, *;q=0.5", "gzip", compressed.Bytes()},
+		{"gzip;q=0", "", page},
+		{"", "", page},
+	} {
+		r := httptest.NewRequest("GET", "/post/hello", nil)
+		if test.accept != "" {
+			r.Header.Set("Accept-Encoding", test.accept)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if got := w.Header().Get("Content-Encoding"); got != test.encoding {
+			t.Errorf("for %q got encoding %q; want %q", test.accept, got, test.encoding)
+		}
+		if !bytes.Equal(w.Body.Bytes(), test.body) {
+			t.Errorf("for %q got body %q; want %q", test.accept, w.Body.Bytes(), test.body)
+		}
+		if got := w.Header().Get("Content-Type"); got != "text/html; charset=utf-8" {
+			t.Errorf("for %q got type %q; want the type of the page", test.accept, got)
+		}
+		if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+			t.Errorf("for %q got Vary %q; want Accept-Encoding", test.accept, got)
+		}
+	}
+}
+
+func TestCompressHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, nil)
+	feed := []byte("<rss>" + strings.Repeat("<item>Hello</item>", 100) + "</rss>")
+	image := bytes.Repeat([]byte{0x89, 'P', 'N', 'G'}, 500)
+	for name, data := range map[string][]byte{"index.xml": feed, "index.html": []byte("<p>Hi</p>"), "logo.png": image} {
+		if err := ioutil.WriteFile(path.Join(config.OutputPath, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		gzip     bool
+		target   string
+		accept   string
+		encoding string
+		body     []byte
+	}{
+		{true, "/index.xml", "gzip", "gzip", feed},
+		{true, "/index.xml", "", "", feed},
+		{false, "/index.xml", "gzip", "", feed},
+		{true, "/", "gzip", "", []byte("<p>Hi</p>")},
+		{true, "/logo.png", "gzip", "", image},
+	} {
+		config.Gzip = test.gzip
+		r := httptest.NewRequest("GET", test.target, nil)
+		if test.accept != "" {
+			r.Header.Set("Accept-Encoding", test.accept)
+		}
+		w := httptest.NewRecorder()
+		serveMux(config, "").ServeHTTP(w, r)
+		if got := w.Header().Get("Content-Encoding"); got != test.encoding {
+			t.Errorf("gzip %v: for %s with %q got encoding %q; want %q", test.gzip, test.target, test.accept, got, test.encoding)
+		}
+		body := w.Body.Bytes()
+		if test.encoding == "gzip" {
+			zr, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if body, err = ioutil.ReadAll(zr); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !bytes.Equal(body, test.body) {
+			t.Errorf("gzip %v: for %s with %q got body %q; want %q", test.gzip, test.target, test.accept, body, test.body)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// fingerprintedName matches the names of fingerprinted assets, e.g.
+// main.0123456789ab.css
+var fingerprintedName = regexp.MustCompile(`\.[0-9a-f]{12}\.[^./]+$`)
+
+type headersHandler struct {
+	noCacheHTML bool
+	h           http.Handler
+}
+
+func (s *headersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := path.Base(r.URL.Path)
+	for _, feed := range feedFormats {
+		if name == feed.Output && feed.ContentType != "" {
+			w.Header().Set("Content-Type", feed.ContentType)
+		}
+	}
+	switch ext := path.Ext(name); {
+	case fingerprintedName.MatchString(name):
+		// a new version of an asset gets a new name
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	case s.noCacheHTML && (strings.HasSuffix(r.URL.Path, "/") || ext == "" || ext == ".html"):
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	s.h.ServeHTTP(w, r)
+}
+
+// HeadersHandler sets the headers of the files served by h that the file
+// server doesn't: the types of the feeds, long-lived caching of fingerprinted
+// assets and, with noCacheHTML, revalidating the pages on every request.
+func HeadersHandler(noCacheHTML bool, h http.Handler) http.Handler {
+	return &headersHandler{noCacheHTML: noCacheHTML, h: h}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestServeHeaders(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, nil)
+	assetsDir := path.Join(config.OutputPath, config.AssetsPrefix)
+	if err := os.MkdirAll(assetsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{
+		"index.xml":                    "<rss></rss>",
+		"feed.json":                    "{}",
+		"index.html":                   "<p>Home</p>",
+		"post/hello.html":              "<p>Hello</p>",
+		"assets/main.0123456789ab.css": "body {}",
+		"assets/main.css":              "body {}",
+	} {
+		if err := ioutil.WriteFile(path.Join(config.OutputPath, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, preview := range []bool{false, true} {
+		config.Preview = preview
+		pageCache := ""
+		if preview {
+			pageCache = "no-cache"
+		}
+		mux := serveMux(config, assetsDir)
+		for _, test := range []struct {
+			target       string
+			contentType  string
+			cacheControl string
+		}{
+			{"/index.xml", "application/rss+xml", ""},
+			{"/feed.json", "application/feed+json", ""},
+			{"/", "text/html; charset=utf-8", pageCache},
+			{"/post/hello", "text/html; charset=utf-8", pageCache},
+			{"/assets/main.0123456789ab.css", "text/css; charset=utf-8", "public, max-age=31536000, immutable"},
+			{"/assets/main.css", "text/css; charset=utf-8", ""},
+		} {
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest("GET", test.target, nil))
+			if got := w.Header().Get("Content-Type"); got != test.contentType {
+				t.Errorf("preview %v: for %q got Content-Type %q; want %q", preview, test.target, got, test.contentType)
+			}
+			if got := w.Header().Get("Cache-Control"); got != test.cacheControl {
+				t.Errorf("preview %v: for %q got Cache-Control %q; want %q", preview, test.target, got, test.cacheControl)
+			}
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/alecthomas/chroma"
+	chromahtml "github.com/alecthomas/chroma/formatters/html"
+	"github.com/alecthomas/chroma/lexers"
+	"github.com/alecthomas/chroma/styles"
+)
+
+// codeStyleFilename is the stylesheet of the highlighted code, in the assets
+const codeStyleFilename = "highlight.css"
+
+// codeFormatter marks up the tokens of code with classes, which the
+// stylesheet of Config.CodeStyle colors
+var codeFormatter = chromahtml.New(chromahtml.WithClasses(true))
+
+// highlightCode writes text highlighted as the code of lang and reports
+// whether lang is a known language
+func highlightCode(out *bytes.Buffer, text []byte, lang string) bool {
+	lexer := lexers.Get(lang)
+	if lexer == nil {
+		return false
+	}
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, string(text))
+	if err != nil {
+		return false
+	}
+	// the style only matters to the stylesheet with classes
+	return codeFormatter.Format(out, styles.Fallback, iterator) == nil
+}
+
+// writeCodeStyle writes the stylesheet of the named style into filename
+func writeCodeStyle(filename, name string) error {
+	style, ok := styles.Registry[name]
+	if !ok {
+		return fmt.Errorf("unknown code style %q", name)
+	}
+	return writeFileAtomic(filename, func(w io.Writer) error {
+		return codeFormatter.WriteCSS(w, style)
+	})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	imgTagRe  = regexp.MustCompile(`<img\s[^>]*>`)
+	imgAttrRe = regexp.MustCompile(`\s([a-zA-Z-]+)(?:\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+)))?`)
+)
+
+// lazyImages adds loading="lazy" to the images of rendered, and the width and
+// height of the images in the assets that have neither, so the page doesn't
+// shift as they load
+func lazyImages(index *Index, rendered []byte) []byte {
+	return imgTagRe.ReplaceAllFunc(rendered, func(tag []byte) []byte {
+		attrs := make(map[string]string)
+		for _, m := range imgAttrRe.FindAllSubmatch(tag, -1) {
+			attrs[strings.ToLower(string(m[1]))] = string(m[2]) + string(m[3]) + string(m[4])
+		}
+		var extra string
+		if _, ok := attrs["loading"]; !ok {
+			extra += ` loading="lazy"`
+		}
+		_, hasWidth := attrs["width"]
+		_, hasHeight := attrs["height"]
+		if !hasWidth && !hasHeight {
+			if width, height, ok := assetDimensions(index, html.UnescapeString(attrs["src"])); ok {
+				extra += fmt.Sprintf(` width="%d" height="%d"`, width, height)
+			}
+		}
+		if extra == "" {
+			return tag
+		}
+		// before the end of the tag, which may be self-closing
+		i := len(tag) - 1
+		if tag[i-1] == '/' {
+			i--
+		}
+		for tag[i-1] == ' ' {
+			i--
+		}
+		return append(append(tag[:i:i], extra...), tag[i:]...)
+	})
+}
+
+// assetDimensions returns the size of the image src points to in the assets
+func assetDimensions(index *Index, src string) (width, height int, ok bool) {
+	prefix := index.assetsURL() + "/"
+	if !strings.HasPrefix(src, prefix) {
+		return 0, 0, false
+	}
+	// Clean keeps the name inside the assets
+	name := path.Clean("/" + strings.TrimPrefix(src, prefix))
+	f, err := os.Open(filepath.Join(index.settings().AssetsPath, filepath.FromSlash(name)))
+	if err != nil {
+		return 0, 0, false
+	}
+	defer f.Close()
+	c, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, 0, false
+	}
+	return c.Width, c.Height, true
+}
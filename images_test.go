@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestLazyImages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := os.Create(path.Join(dir, "photo.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, image.NewRGBA(image.Rect(0, 0, 64, 48))); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	config := defaultConfig()
+	config.AssetsPath = dir
+	config.LazyImages = true
+	post := &Post{Index: &Index{config: config}}
+	body := "---\ntitle: Photos\n---\n" +
+		"![local](/assets/photo.png)\n\n" +
+		"![remote](https://example.com/photo.png)\n\n" +
+		"![missing](/assets/missing.png)\n\n" +
+		`<img src="/assets/photo.png" width="32" loading="eager">` + "\n"
+	if err := post.Read(context.Background(), "photos.md", []byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	got := string(post.Body)
+	for _, want := range []string{
+		`<img src="/assets/photo.png" alt="local" loading="lazy" width="64" height="48"`,
+		`<img src="https://example.com/photo.png" alt="remote" loading="lazy"`,
+		`<img src="/assets/missing.png" alt="missing" loading="lazy"`,
+		`<img src="/assets/photo.png" width="32" loading="eager">`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got %q; want it to contain %q", got, want)
+		}
+	}
+	if n := strings.Count(got, "width="); n != 2 {
+		t.Errorf("got %d widths in %q; want only the local image sized", n, got)
+	}
+}
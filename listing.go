@@ -0,0 +1,53 @@
+package main
+
+import (
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+)
+
+var listingTmpl = template.Must(template.New("listing").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Index of {{.Path}}</title></head>
+<body>
+<h1>Index of {{.Path}}</h1>
+<table>
+<tr><th>Name</th><th>Size</th><th>Modified</th></tr>
+{{- range .Files}}
+<tr><td><a href="{{.Name}}{{if .IsDir}}/{{end}}">{{.Name}}{{if .IsDir}}/{{end}}</a></td><td>{{if not .IsDir}}{{.Size}}{{end}}</td><td>{{.ModTime.Format "2006-01-02 15:04"}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+type listingHandler struct {
+	dir string
+	h   http.Handler
+}
+
+func (l *listingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		l.h.ServeHTTP(w, r)
+		return
+	}
+	logger.Info(r.Method, r.URL.String())
+	files, err := ioutil.ReadDir(path.Join(l.dir, path.Clean("/"+r.URL.Path)))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	listingTmpl.Execute(w, map[string]interface{}{
+		"Path":  r.URL.Path,
+		"Files": files,
+	})
+}
+
+// ListingHandler renders the directories of dir as a listing of their files,
+// other requests are served by h
+func ListingHandler(dir string, h http.Handler) http.Handler {
+	return &listingHandler{dir: dir, h: h}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestAssetListing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, nil)
+	if err := os.MkdirAll(path.Join(config.AssetsPath, "img"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(config.AssetsPath, "main.css"), []byte("body {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	serveMux(config, config.AssetsPath).ServeHTTP(w, httptest.NewRequest("GET", "/assets/", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("got status %d; want %d without -asset-listing", w.Code, http.StatusNotFound)
+	}
+
+	config.AssetListing = true
+	mux := serveMux(config, config.AssetsPath)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/assets/", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d; want %d", w.Code, http.StatusOK)
+	}
+	for _, want := range []string{`<a href="img/">img/</a>`, `<a href="main.css">main.css</a></td><td>8</td>`} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("got %q; want it to contain %q", w.Body.String(), want)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/assets/main.css", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "body {}\n" {
+		t.Errorf("got %d %q; want the asset served", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/post/", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("got status %d; want %d outside of the assets", w.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// liveReloadPath is where served pages connect to hear of rebuilds
+	liveReloadPath = "/_blgo/livereload"
+
+	// websocketGUID is the key suffix of the WebSocket handshake, RFC 6455
+	websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+// liveReloadScript reloads the page on any message, reconnecting to survive
+// restarts of the server
+const liveReloadScript = `<script>
+(function connect() {
+	var ws = new WebSocket((location.protocol == "https:" ? "wss://" : "ws://") + location.host + "` + liveReloadPath + `");
+	ws.onmessage = function() { location.reload(); };
+	ws.onclose = function() { setTimeout(connect, 1000); };
+})();
+</script>
+`
+
+// liveReload tells the pages connected over WebSocket to reload
+type liveReload struct {
+	mu    sync.Mutex
+	conns map[net.Conn]bool
+}
+
+func newLiveReload() *liveReload {
+	return &liveReload{conns: make(map[net.Conn]bool)}
+}
+
+// ServeHTTP accepts the WebSocket connections of pages
+func (lr *liveReload) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || key == "" {
+		http.Error(w, "expected a WebSocket handshake", http.StatusBadRequest)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "connection can't be upgraded", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		logger.Info("livereload:", err)
+		return
+	}
+	// registered first so a rebuild right after the handshake reaches it
+	lr.mu.Lock()
+	lr.conns[conn] = true
+	accept := sha1.Sum([]byte(key + websocketGUID))
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(accept[:]) + "\r\n\r\n")
+	err = rw.Flush()
+	lr.mu.Unlock()
+	if err != nil {
+		lr.remove(conn)
+		return
+	}
+	// pages never send anything but a close, reading notices it
+	go func(r *bufio.Reader) {
+		io.Copy(ioutil.Discard, r)
+		lr.remove(conn)
+	}(rw.Reader)
+}
+
+func (lr *liveReload) remove(conn net.Conn) {
+	lr.mu.Lock()
+	delete(lr.conns, conn)
+	lr.mu.Unlock()
+	conn.Close()
+}
+
+// Reload tells the connected pages to reload
+func (lr *liveReload) Reload() {
+	// an unmasked text frame, which is how servers send
+	msg := "reload"
+	frame := append([]byte{0x81, byte(len(msg))}, msg...)
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	for conn := range lr.conns {
+		conn.SetWriteDeadline(time.Now().Add(time.Second))
+		if _, err := conn.Write(frame); err != nil {
+			delete(lr.conns, conn)
+			conn.Close()
+		}
+	}
+}
+
+// Handler serves the WebSocket endpoint and the pages of h with the script
+// connecting to it
+func (lr *liveReload) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == liveReloadPath {
+			lr.ServeHTTP(w, r)
+			return
+		}
+		if r.Method != http.MethodGet {
+			h.ServeHTTP(w, r)
+			return
+		}
+		// compressed pages can't have the script added
+		r.Header.Del("Accept-Encoding")
+		iw := &injectingWriter{ResponseWriter: w}
+		h.ServeHTTP(iw, r)
+		if !iw.html {
+			return
+		}
+		page := iw.buf.Bytes()
+		if i := bytes.LastIndex(page, []byte("</body>")); i >= 0 {
+			page = append(page[:i:i], append([]byte(liveReloadScript), page[i:]...)...)
+		} else {
+			page = append(page, liveReloadScript...)
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(page)))
+		w.WriteHeader(iw.status)
+		w.Write(page)
+	})
+}
+
+// injectingWriter holds back successful HTML responses for adding the script,
+// passing the others through
+type injectingWriter struct {
+	http.ResponseWriter
+	buf         bytes.Buffer
+	html        bool
+	status      int
+	wroteHeader bool
+}
+
+func (w *injectingWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if status == http.StatusOK && strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		w.html = true
+		w.status = status
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *injectingWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.html {
+		return w.buf.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLiveReloadInjection(t *testing.T) {
+	h := newLiveReload().Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/post/hello.html":
+			w.Header().Set("Content-Length", "40")
+			w.Write([]byte("<html><body><p>Hello</p></body></html>\n"))
+		case "/assets/style.css":
+			w.Header().Set("Content-Type", "text/css")
+			w.Write([]byte("</body>"))
+		}
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/post/hello.html", nil))
+	if want := "<p>Hello</p>" + liveReloadScript + "</body></html>\n"; !strings.Contains(w.Body.String(), want) {
+		t.Errorf("got page %q; want the script before </body>", w.Body.String())
+	}
+	if got, want := w.Header().Get("Content-Length"), w.Body.Len(); got != strconv.Itoa(want) {
+		t.Errorf("got Content-Length %s; want %d", got, want)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/assets/style.css", nil))
+	if w.Body.String() != "</body>" {
+		t.Errorf("got stylesheet %q; want it unchanged", w.Body.String())
+	}
+}
+
+func TestLiveReloadMessage(t *testing.T) {
+	lr := newLiveReload()
+	server := httptest.NewServer(lr.Handler(http.NotFoundHandler()))
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	io.WriteString(conn, "GET "+liveReloadPath+" HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the accept key of the example handshake of RFC 6455
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("got %s with accept %q; want the handshake", resp.Status, resp.Header.Get("Sec-WebSocket-Accept"))
+	}
+
+	lr.Reload()
+	frame := make([]byte, 8)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte("\x81\x06reload"); !bytes.Equal(frame, want) {
+		t.Errorf("got frame %q; want %q", frame, want)
+	}
+}
@@ -0,0 +1,36 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"syscall"
+)
+
+// lockFilename is the file in the output path locked while blgo runs
+const lockFilename = ".blgo.lock"
+
+// acquireLock locks outputPath against other blgo processes and returns the
+// function that unlocks it. The lock is released by the OS if the process
+// dies without calling it.
+func acquireLock(outputPath string) (func() error, error) {
+	filename := path.Join(outputPath, lockFilename)
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, fmt.Errorf("%s is locked, another blgo is building into %s", filename, outputPath)
+		}
+		return nil, err
+	}
+	return func() error {
+		defer f.Close()
+		return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	}, nil
+}
@@ -0,0 +1,35 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestAcquireLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	release, err := acquireLock(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := acquireLock(dir); err == nil {
+		t.Fatal("got the lock while it is held")
+	}
+	if err := release(); err != nil {
+		t.Fatal(err)
+	}
+
+	release, err = acquireLock(dir)
+	if err != nil {
+		t.Fatalf("got %v; want the lock once released", err)
+	}
+	release()
+}
@@ -0,0 +1,9 @@
+package main
+
+// lockFilename is the file in the output path locked while blgo runs
+const lockFilename = ".blgo.lock"
+
+// acquireLock does not lock on Windows, which has no flock
+func acquireLock(outputPath string) (func() error, error) {
+	return func() error { return nil }, nil
+}
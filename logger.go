@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// logLevel selects the messages a Logger writes
+type logLevel int
+
+const (
+	// logQuiet writes the errors and the summary of a build only
+	logQuiet logLevel = iota - 1
+	// logNormal also writes informational messages, e.g. warnings and
+	// served requests
+	logNormal
+	// logVerbose also writes debugging messages, e.g. the time each post
+	// took and the templates parsed
+	logVerbose
+)
+
+// Logger is a log.Logger that drops the messages above its level
+type Logger struct {
+	*log.Logger
+	Level logLevel
+}
+
+// newLogger returns a logger writing to w with the standard flags
+func newLogger(w io.Writer, level logLevel) *Logger {
+	return &Logger{Logger: log.New(w, "", log.LstdFlags), Level: level}
+}
+
+// logger is where blgo logs, replaced by tests to capture the logs
+var logger = newLogger(os.Stderr, logNormal)
+
+// Error logs like log.Println at every level
+func (l *Logger) Error(v ...interface{}) {
+	l.Output(2, fmt.Sprintln(v...))
+}
+
+// Info logs like log.Println unless quiet
+func (l *Logger) Info(v ...interface{}) {
+	if l.Level >= logNormal {
+		l.Output(2, fmt.Sprintln(v...))
+	}
+}
+
+// Infof logs like log.Printf unless quiet
+func (l *Logger) Infof(format string, v ...interface{}) {
+	if l.Level >= logNormal {
+		l.Output(2, fmt.Sprintf(format, v...))
+	}
+}
+
+// Debugf logs like log.Printf when verbose
+func (l *Logger) Debugf(format string, v ...interface{}) {
+	if l.Level >= logVerbose {
+		l.Output(2, fmt.Sprintf(format, v...))
+	}
+}
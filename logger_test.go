@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// captureLogs makes logger write at level to the returned buffer until
+// restore is called
+func captureLogs(level logLevel) (logs *bytes.Buffer, restore func()) {
+	saved := logger
+	logs = new(bytes.Buffer)
+	logger = newLogger(logs, level)
+	return logs, func() { logger = saved }
+}
+
+func TestVerbose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"hello.md": "---\ntitle: Hello\ndate: 2017-01-01\n---\nHello.\n",
+	})
+
+	logs, restore := captureLogs(logVerbose)
+	defer restore()
+	if _, err := buildAll(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"read " + config.SourcePath + "/hello.md in ", "wrote post/hello.html in ", "parsed template " + config.TemplatesPath + "/" + postTmplFilename} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("got logs %q; want them to contain %q", logs.String(), want)
+		}
+	}
+
+	logs.Reset()
+	logger.Level = logNormal
+	if _, err := buildAll(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	if logs.Len() != 0 {
+		t.Errorf("got logs %q; want none by default", logs.String())
+	}
+}
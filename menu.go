@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// MenuItem is an entry of the site navigation
+type MenuItem struct {
+	Title  string
+	URL    string
+	Weight int
+}
+
+// readMenu reads the menu and menu_weight keys of a post, a menu of true
+// lists the post under its title and a string under that title instead.
+// The returned title is empty for posts outside the menu.
+func readMenu(frontmatter map[string]interface{}, title string) (string, int, error) {
+	var weight int
+	if v, ok := frontmatter["menu_weight"]; ok {
+		if weight, ok = v.(int); !ok {
+			return "", 0, fmt.Errorf("invalid menu_weight: expected an integer, got %v", v)
+		}
+	}
+	switch v := frontmatter["menu"].(type) {
+	case nil:
+		return "", weight, nil
+	case bool:
+		if v {
+			return title, weight, nil
+		}
+		return "", weight, nil
+	case string:
+		return v, weight, nil
+	default:
+		return "", 0, fmt.Errorf("invalid menu: expected a bool or a string, got %v", v)
+	}
+}
+
+// menu returns the menu items of posts by weight, the lightest first, and
+// in the order of posts for equal weights
+func menu(posts []*Post) []MenuItem {
+	var items []MenuItem
+	for _, post := range posts {
+		if post.Menu != "" {
+			items = append(items, MenuItem{Title: post.Menu, URL: post.RelativeLink, Weight: post.MenuWeight})
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Weight < items[j].Weight })
+	return items
+}
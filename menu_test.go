@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestMenu(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"about.md":    "---\ntitle: About me\ndate: 2017-01-01\nmenu: About\nmenu_weight: 20\n---\nAbout.\n",
+		"projects.md": "---\ntitle: Projects\ndate: 2017-01-02\nmenu: true\nmenu_weight: 10\n---\nProjects.\n",
+		"contact.md":  "---\ntitle: Contact\ndate: 2017-01-03\nmenu: true\nmenu_weight: 30\n---\nContact.\n",
+		"hello.md":    "---\ntitle: Hello\ndate: 2017-01-04\n---\nHello.\n",
+		"draft.md":    "---\ntitle: Draft\ndate: 2017-01-05\nmenu: true\ndraft: true\n---\nDraft.\n",
+	})
+	nav := `{{range .Site.Menu}}{{.Title}} {{.URL}} {{.Weight}}
+{{end}}`
+	if err := ioutil.WriteFile(path.Join(config.TemplatesPath, indexTmplFilename), []byte(nav), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buildAll(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(path.Join(config.OutputPath, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Projects /post/projects 10\nAbout /post/about 20\nContact /post/contact 30\n"; string(got) != want {
+		t.Errorf("got menu %q; want %q", got, want)
+	}
+}
+
+func TestReadMenuErrors(t *testing.T) {
+	for text, want := range map[string]string{
+		"menu: [a]\n":                      "x.md: invalid menu: expected a bool or a string, got [a]",
+		"menu: true\nmenu_weight: heavy\n": "x.md: invalid menu_weight: expected an integer, got heavy",
+	} {
+		post := &Post{Index: &Index{config: defaultConfig()}}
+		err := post.Read(context.Background(), "x.md", []byte("---\ntitle: X\n"+text+"---\nX.\n"))
+		if got := errorString(err); got != want {
+			t.Errorf("for %q got error %q; want %q", text, got, want)
+		}
+	}
+}
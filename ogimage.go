@@ -0,0 +1,89 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	ogImageDir    = "og"
+	ogImageWidth  = 1200
+	ogImageHeight = 630
+
+	// the text is drawn at ogImageScale times smaller and scaled up, since
+	// the only bundled font is a small bitmap font
+	ogImageScale  = 3
+	ogImageMargin = 16
+)
+
+var (
+	ogImageBackground = color.RGBA{0x22, 0x22, 0x22, 0xff}
+	ogImageForeground = color.RGBA{0xee, 0xee, 0xee, 0xff}
+)
+
+// drawOGImage draws an Open Graph image with the post title over a plain
+// background and the blog title at the bottom
+func drawOGImage(title, site string) image.Image {
+	small := image.NewRGBA(image.Rect(0, 0, ogImageWidth/ogImageScale, ogImageHeight/ogImageScale))
+	draw.Draw(small, small.Bounds(), image.NewUniform(ogImageBackground), image.Point{}, draw.Src)
+
+	d := &font.Drawer{
+		Dst:  small,
+		Src:  image.NewUniform(ogImageForeground),
+		Face: basicfont.Face7x13,
+	}
+	lineHeight := basicfont.Face7x13.Height + 3
+	y := ogImageMargin + basicfont.Face7x13.Ascent
+	for _, line := range wrapText(d, title, fixed.I(small.Bounds().Dx()-2*ogImageMargin)) {
+		d.Dot = fixed.P(ogImageMargin, y)
+		d.DrawString(line)
+		y += lineHeight
+	}
+	d.Dot = fixed.P(ogImageMargin, small.Bounds().Dy()-ogImageMargin)
+	d.DrawString(site)
+
+	img := image.NewRGBA(image.Rect(0, 0, ogImageWidth, ogImageHeight))
+	draw.NearestNeighbor.Scale(img, img.Bounds(), small, small.Bounds(), draw.Src, nil)
+	return img
+}
+
+// wrapText splits text into lines no wider than width
+func wrapText(d *font.Drawer, text string, width fixed.Int26_6) []string {
+	var lines []string
+	var line string
+	for _, word := range strings.Fields(text) {
+		if line != "" && d.MeasureString(line+" "+word) > width {
+			lines = append(lines, line)
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// writeOGImage writes the Open Graph image of post to filename
+func writeOGImage(filename string, post *Post) error {
+	if err := os.MkdirAll(path.Dir(filename), 0755); err != nil {
+		return err
+	}
+	img := drawOGImage(post.Title, post.Index.Title)
+	return writeFileAtomic(filename, func(w io.Writer) error {
+		return png.Encode(w, img)
+	})
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestOGImages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"plain.md": "---\ntitle: A post without an image of its own\ndate: 2017-01-01\n---\nHello.\n",
+		"cover.md": "---\ntitle: Covered\ndate: 2017-01-02\nimage: https://example.com/assets/cover.png\n---\nHello.\n",
+	})
+	config.OGImages = true
+	if _, err := buildAll(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path.Join(config.OutputPath, ogImageDir, "plain.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.DecodeConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Width != ogImageWidth || img.Height != ogImageHeight {
+		t.Errorf("got %dx%d; want %dx%d", img.Width, img.Height, ogImageWidth, ogImageHeight)
+	}
+
+	if _, err := os.Stat(path.Join(config.OutputPath, ogImageDir, "cover.png")); !os.IsNotExist(err) {
+		t.Errorf("got %v; want no image generated for a post with an image", err)
+	}
+}
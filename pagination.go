@@ -0,0 +1,65 @@
+package main
+
+import (
+	"path"
+	"strconv"
+	"strings"
+)
+
+// pageDir is the directory of the pages of the index after the first
+const pageDir = "page"
+
+// Pagination describes a page of the index when it is split by
+// Config.PerPage
+type Pagination struct {
+	Page  int
+	Pages int
+	// PrevLink and NextLink are the links to the pages of newer and older
+	// posts, empty on the first and the last page
+	PrevLink string
+	NextLink string
+}
+
+// pageFilename returns the output filename of page n of the index
+func pageFilename(n int) string {
+	if n == 1 {
+		return "index.html"
+	}
+	return path.Join(pageDir, strconv.Itoa(n)+".html")
+}
+
+// pageLink returns the link to page n of the index
+func (index *Index) pageLink(n int) string {
+	if n == 1 {
+		return strings.TrimSuffix(index.link(), "/") + "/"
+	}
+	return index.link(pageDir, strconv.Itoa(n))
+}
+
+// paginate returns copies of the index listing perPage of its non-draft posts
+// each, and at least one even without posts
+func (index *Index) paginate(perPage int) []*Index {
+	published := index.filter(func(post *Post) bool { return !post.Draft }).Posts
+	n := (len(published) + perPage - 1) / perPage
+	if n == 0 {
+		n = 1
+	}
+	pages := make([]*Index, n)
+	for i := range pages {
+		page := *index
+		start, end := i*perPage, (i+1)*perPage
+		if end > len(published) {
+			end = len(published)
+		}
+		page.Posts = published[start:end]
+		page.Pagination = &Pagination{Page: i + 1, Pages: n}
+		if i > 0 {
+			page.Pagination.PrevLink = index.pageLink(i)
+		}
+		if i+1 < n {
+			page.Pagination.NextLink = index.pageLink(i + 2)
+		}
+		pages[i] = &page
+	}
+	return pages
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestPagination(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sources := map[string]string{
+		"draft.md": "---\ntitle: Draft\ndate: 2017-01-30\ndraft: true\n---\nDraft.\n",
+	}
+	for i := 1; i <= 5; i++ {
+		sources[fmt.Sprintf("p%d.md", i)] = fmt.Sprintf("---\ntitle: P%d\ndate: 2017-01-%02d\n---\nP.\n", i, i)
+	}
+	config := newTestSite(t, dir, sources)
+	config.Subdir = "preview"
+	config.Drafts = true
+	config.PerPage = 2
+	nav := "{{range .Posts}}{{.Title}} {{end}}{{with .Pagination}}{{.Page}}/{{.Pages}} [{{.PrevLink}}] [{{.NextLink}}]{{end}}"
+	if err := ioutil.WriteFile(path.Join(config.TemplatesPath, indexTmplFilename), []byte(nav), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buildAll(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	for filename, want := range map[string]string{
+		"index.html":  "P5 P4 1/3 [] [/preview/page/2]",
+		"page/2.html": "P3 P2 2/3 [/preview/] [/preview/page/3]",
+		"page/3.html": "P1 3/3 [/preview/page/2] []",
+	} {
+		got, err := ioutil.ReadFile(path.Join(config.OutputPath, config.Subdir, filename))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s: got %q; want %q", filename, got, want)
+		}
+	}
+
+	// without PerPage the index is a single page
+	config.PerPage = 0
+	if _, err := buildAll(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(path.Join(config.OutputPath, config.Subdir, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Draft P5 P4 P3 P2 P1 "; string(got) != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
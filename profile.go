@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// profileBuild runs buildAll writing a CPU profile of it to cpuprofile and a
+// heap profile after it to memprofile, each unless empty
+func profileBuild(ctx context.Context, config *Config, cpuprofile, memprofile string) ([]string, error) {
+	if cpuprofile != "" {
+		f, err := os.Create(cpuprofile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if err := pprof.StartCPUProfile(f); err != nil {
+			return nil, err
+		}
+		defer pprof.StopCPUProfile()
+	}
+
+	generated, err := buildAll(ctx, config)
+	if err != nil || memprofile == "" {
+		return generated, err
+	}
+
+	f, err := os.Create(memprofile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	runtime.GC() // up-to-date statistics
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		return nil, err
+	}
+	return generated, f.Close()
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestProfileBuild(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"hello.md": "---\ntitle: Hello\ndate: 2017-01-01\n---\nHello.\n",
+	})
+	want, err := buildAll(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cpuprofile, memprofile := path.Join(dir, "cpu.prof"), path.Join(dir, "mem.prof")
+	got, err := profileBuild(context.Background(), config, cpuprofile, memprofile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q generated; want %q as without profiling", got, want)
+	}
+	for _, filename := range []string{cpuprofile, memprofile} {
+		if stat, err := os.Stat(filename); err != nil || stat.Size() == 0 {
+			t.Errorf("got %v; want a profile written to %s", err, filename)
+		}
+	}
+}
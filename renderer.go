@@ -2,6 +2,11 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"os/exec"
+	"strings"
 
 	"github.com/russross/blackfriday"
 	"golang.org/x/tools/godoc"
@@ -9,6 +14,26 @@ import (
 
 type Renderer struct {
 	*blackfriday.Html
+
+	// permalinks adds a link to itself to each heading with an ID
+	permalinks bool
+
+	// headings collects the rendered headings when not nil
+	headings *[]Heading
+
+	// highlight colors the code blocks of known languages with classes
+	highlight bool
+
+	// ids counts the uses of each heading ID
+	ids map[string]int
+}
+
+// Heading is a heading of a rendered post, e.g. for in-page navigation
+type Heading struct {
+	Level int
+	Text  string
+	// ID is the fragment linking to the heading, empty if it has none
+	ID string
 }
 
 const commonHtmlFlags = 0 |
@@ -30,31 +55,134 @@ const commonExtensions = 0 |
 	blackfriday.EXTENSION_BACKSLASH_LINE_BREAK |
 	blackfriday.EXTENSION_DEFINITION_LISTS
 
-var (
-	bfHtmlRenderer = blackfriday.HtmlRenderer(commonHtmlFlags, "", "")
-	renderer       = &Renderer{Html: bfHtmlRenderer.(*blackfriday.Html)}
-)
+// newRenderer returns a renderer for a single document. blackfriday's Html
+// keeps state such as the header IDs in use, so renderers aren't shared.
+func newRenderer() *Renderer {
+	return &Renderer{Html: blackfriday.HtmlRenderer(commonHtmlFlags, "", "").(*blackfriday.Html)}
+}
+
+// uniqueID returns id, or id with a numeric suffix if a heading already has
+// it, e.g. "intro-1" for the second "intro". blackfriday does the same, but
+// after the ID is collected for the table of contents.
+func (options *Renderer) uniqueID(id string) string {
+	if options.ids == nil {
+		options.ids = make(map[string]int)
+	}
+	unique := id
+	for options.ids[unique] > 0 {
+		unique = fmt.Sprintf("%s-%d", id, options.ids[id])
+		options.ids[id]++
+	}
+	options.ids[unique]++
+	return unique
+}
+
+func (options *Renderer) Header(out *bytes.Buffer, text func() bool, level int, id string) {
+	if id != "" {
+		id = options.uniqueID(id)
+	}
+	start := out.Len()
+	options.Html.Header(out, text, level, id)
+	if options.headings != nil && out.Len() > start {
+		*options.headings = append(*options.headings, Heading{
+			Level: level,
+			Text:  plaintext(out.Bytes()[start:]),
+			ID:    id,
+		})
+	}
+	if !options.permalinks || id == "" {
+		return
+	}
+	// insert the link before the closing tag, text writes to out directly
+	closing := fmt.Sprintf("</h%d>\n", level)
+	if !bytes.HasSuffix(out.Bytes(), []byte(closing)) {
+		return
+	}
+	out.Truncate(out.Len() - len(closing))
+	fmt.Fprintf(out, ` <a class="permalink" href="#%s">#</a>%s`, id, closing)
+}
 
 func (options *Renderer) BlockCode(out *bytes.Buffer,
 	text []byte, lang string) {
 	switch lang {
 	case "go":
+		if options.highlight && highlightCode(out, text, lang) {
+			break
+		}
 		out.WriteString("<pre>")
 		godoc.FormatText(out, text, -1, true, "", nil)
 		out.WriteString("</pre>")
 	case "shell":
 		out.WriteString("<div class='shell'>")
-		bfHtmlRenderer.BlockCode(out, text, lang)
+		options.Html.BlockCode(out, text, lang)
 		out.WriteString("</div>")
 	case "output":
 		out.WriteString("<div class='output'>")
-		bfHtmlRenderer.BlockCode(out, text, lang)
+		options.Html.BlockCode(out, text, lang)
 		out.WriteString("</div>")
 	case "notebox":
 		out.WriteString("<div class='notebox'>")
 		out.Write(blackfriday.MarkdownCommon(text))
 		out.WriteString("</div>")
 	default:
-		bfHtmlRenderer.BlockCode(out, text, lang)
+		if lang != "" && options.highlight && highlightCode(out, text, lang) {
+			break
+		}
+		options.Html.BlockCode(out, text, lang)
+	}
+}
+
+// runRenderer renders body with an external command, which reads it from
+// stdin and writes the HTML to stdout. The command is killed when ctx is
+// canceled.
+func runRenderer(ctx context.Context, command string, body []byte) ([]byte, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty renderer command")
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v: %s", command, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return out, nil
+}
+
+// tableOfContents returns the headings as nested lists of links, empty if
+// there are none
+func tableOfContents(headings []Heading) string {
+	if len(headings) == 0 {
+		return ""
+	}
+	var buf bytes.Buffer
+	buf.WriteString(`<nav class="toc">`)
+	// levels holds the level of each open list
+	var levels []int
+	for _, h := range headings {
+		switch {
+		case len(levels) == 0 || h.Level > levels[len(levels)-1]:
+			buf.WriteString("<ul><li>")
+			levels = append(levels, h.Level)
+		default:
+			for len(levels) > 1 && h.Level < levels[len(levels)-1] {
+				buf.WriteString("</li></ul>")
+				levels = levels[:len(levels)-1]
+			}
+			buf.WriteString("</li><li>")
+		}
+		text := html.EscapeString(h.Text)
+		if h.ID != "" {
+			fmt.Fprintf(&buf, `<a href="#%s">%s</a>`, html.EscapeString(h.ID), text)
+		} else {
+			buf.WriteString(text)
+		}
+	}
+	for range levels {
+		buf.WriteString("</li></ul>")
 	}
+	buf.WriteString("</nav>")
+	return buf.String()
 }
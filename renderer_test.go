@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRendererCmd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"raw.html": "---\ntitle: Raw\ndate: 2017-01-01\n---\n<p>*not markdown*</p>\n",
+		"hello.md": "---\ntitle: Hello\ndate: 2017-01-02\n---\n**markdown**\n",
+	})
+	config.RendererCmd = "cat"
+	config.RendererExts = []string{".html"}
+	if _, err := buildAll(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	for filename, want := range map[string]string{
+		"raw.html":   "Raw\n<p>*not markdown*</p>\n",
+		"hello.html": "Hello\n<p><strong>markdown</strong></p>\n",
+	} {
+		got, err := ioutil.ReadFile(path.Join(config.OutputPath, "post", filename))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s: got %q; want %q", filename, got, want)
+		}
+	}
+
+	config.RendererCmd = "sh -c false"
+	post := &Post{Index: &Index{config: config}}
+	if err := post.Read(context.Background(), "raw.html", []byte("---\ntitle: Raw\n---\nRaw.\n")); err == nil || !strings.Contains(err.Error(), "exit status 1") {
+		t.Errorf("got %v; want the renderer's exit status", err)
+	}
+}
+
+func TestRendererCmdCanceled(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("no sleep command")
+	}
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"slow.html": "---\ntitle: Slow\ndate: 2017-01-01\n---\nSlow.\n",
+	})
+	config.RendererCmd = "sleep 60"
+	config.RendererExts = []string{".html"}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	if _, err := buildAll(ctx, config); err != context.Canceled {
+		t.Errorf("got %v; want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("got a build of %v; want the renderer stopped when canceled", elapsed)
+	}
+}
+
+func TestHeadingPermalinks(t *testing.T) {
+	config := defaultConfig()
+	config.HeadingPermalinks = true
+	post := &Post{Index: &Index{config: config, URL: "https://example.com/"}}
+	if err := post.Read(context.Background(), "hello.md", []byte("---\ntitle: Hello\n---\n## Getting started\n\nHello.\n")); err != nil {
+		t.Fatal(err)
+	}
+	if want := `<h2 id="getting-started">Getting started <a class="permalink" href="#getting-started">#</a></h2>`; !strings.Contains(string(post.Body), want) {
+		t.Errorf("got body %q; want it to contain %q", post.Body, want)
+	}
+	if want := `<a class="permalink" href="https://example.com/post/hello#getting-started">#</a>`; !strings.Contains(post.FeedBody, want) {
+		t.Errorf("got feed body %q; want it to contain %q", post.FeedBody, want)
+	}
+
+	config.HeadingPermalinks = false
+	if err := post.Read(context.Background(), "hello.md", []byte("---\ntitle: Hello\n---\n## Getting started\n\nHello.\n")); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(post.Body), "permalink") {
+		t.Errorf("got body %q; want no permalinks by default", post.Body)
+	}
+}
+
+func TestHeadings(t *testing.T) {
+	config := defaultConfig()
+	config.HeadingPermalinks = true
+	post := &Post{Index: &Index{config: config}}
+	body := "---\ntitle: Hello\n---\n## Getting **started**\n\nHello.\n\n### Install\n\n```\n# not a heading\n```\n\n## Next steps\n"
+	if err := post.Read(context.Background(), "hello.md", []byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	want := []Heading{
+		{Level: 2, Text: "Getting started", ID: "getting-started"},
+		{Level: 3, Text: "Install", ID: "install"},
+		{Level: 2, Text: "Next steps", ID: "next-steps"},
+	}
+	if !reflect.DeepEqual(post.Headings, want) {
+		t.Errorf("got headings %+v; want %+v", post.Headings, want)
+	}
+}
+
+func TestTableOfContents(t *testing.T) {
+	index := &Index{config: defaultConfig()}
+	if err := index.ReadFrontmatter([]byte(strings.Replace(testSettings, "---\n", "---\ntoc: true\n", 1))); err != nil {
+		t.Fatal(err)
+	}
+	body := "\n## Getting started\n\n### Install\n\n## Next & last\n"
+
+	post := &Post{Index: index}
+	if err := post.Read(context.Background(), "hello.md", []byte("---\ntitle: Hello\n---"+body)); err != nil {
+		t.Fatal(err)
+	}
+	want := `<nav class="toc"><ul><li><a href="#getting-started">Getting started</a><ul><li><a href="#install">Install</a></li></ul></li><li><a href="#next-last">Next &amp; last</a></li></ul></nav>`
+	if string(post.TOC) != want {
+		t.Errorf("got TOC %q; want %q", post.TOC, want)
+	}
+
+	if err := post.Read(context.Background(), "short.md", []byte("---\ntitle: Short\ntoc: false\n---"+body)); err != nil {
+		t.Fatal(err)
+	}
+	if post.TOC != "" {
+		t.Errorf("got TOC %q; want none with toc: false", post.TOC)
+	}
+
+	post = &Post{Index: &Index{config: defaultConfig()}}
+	if err := post.Read(context.Background(), "long.md", []byte("---\ntitle: Long\ntoc: true\n---"+body)); err != nil {
+		t.Fatal(err)
+	}
+	if post.TOC == "" {
+		t.Error("got no TOC with toc: true and no site-wide default")
+	}
+}
+
+func TestUniqueHeadingIDs(t *testing.T) {
+	post := &Post{Index: &Index{config: defaultConfig()}}
+	body := "---\ntitle: Hello\ntoc: true\n---\n## Intro\n\n## Intro\n\n## Intro 1\n\n## Intro\n"
+	if err := post.Read(context.Background(), "hello.md", []byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"intro", "intro-1", "intro-1-1", "intro-2"} {
+		if want := `<h2 id="` + id + `">`; !strings.Contains(string(post.Body), want) {
+			t.Errorf("got body %q; want it to contain %q", post.Body, want)
+		}
+		if want := `<a href="#` + id + `">`; !strings.Contains(string(post.TOC), want) {
+			t.Errorf("got TOC %q; want it to contain %q", post.TOC, want)
+		}
+	}
+}
+
+func TestHighlightCode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"code.md": "---\ntitle: Code\ndate: 2017-01-01\n---\n" +
+			"```go\nfunc main() {}\n```\n\n" +
+			"```\nplain <text>\n```\n\n" +
+			"```nosuchlang\nfunc x\n```\n",
+	})
+	config.CodeStyle = "github"
+	config.AllowHTML = false
+	generated, err := buildAll(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(strings.Join(generated, " "), "assets/"+codeStyleFilename) {
+		t.Errorf("got generated %q; want the stylesheet", generated)
+	}
+	if _, err := os.Stat(path.Join(config.OutputPath, "assets", codeStyleFilename)); err != nil {
+		t.Error(err)
+	}
+	// serve mode serves the assets of the output, which has the stylesheet
+	w := httptest.NewRecorder()
+	serveMux(config, config.outputAssetsPath()).ServeHTTP(w, httptest.NewRequest("GET", "/assets/"+codeStyleFilename, nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("got status %d serving the stylesheet; want %d", w.Code, http.StatusOK)
+	}
+
+	post := &Post{Index: &Index{config: config}}
+	if err := post.ReadFile(context.Background(), path.Join(config.SourcePath, "code.md")); err != nil {
+		t.Fatal(err)
+	}
+	body := string(post.Body)
+	for _, want := range []string{
+		`<pre class="chroma"><code><span class="kd">func</span>`,
+		"<pre><code>plain &lt;text&gt;\n</code></pre>",
+		`<pre><code class="language-nosuchlang">func x`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("got %q; want it to contain %q", body, want)
+		}
+	}
+
+	config.CodeStyle = "nosuchstyle"
+	if _, err := buildAll(context.Background(), config); errorString(err) != `unknown code style "nosuchstyle"` {
+		t.Errorf("got error %v; want the unknown style", err)
+	}
+}
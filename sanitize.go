@@ -0,0 +1,24 @@
+package main
+
+import (
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// htmlPolicy is the allowlist that posts are sanitized with unless raw HTML
+// is allowed
+var htmlPolicy = newHTMLPolicy()
+
+// embedSrcRe matches the iframe sources of the built-in embed shortcodes
+var embedSrcRe = regexp.MustCompile(`^https://(www\.youtube\.com/embed/|player\.vimeo\.com/video/)`)
+
+func newHTMLPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	// keep the classes of the highlighted code blocks and the shortcode embeds
+	p.AllowAttrs("class").Globally()
+	p.AllowElements("iframe")
+	p.AllowAttrs("width", "height", "frameborder", "allowfullscreen").OnElements("iframe")
+	p.AllowAttrs("src").Matching(embedSrcRe).OnElements("iframe")
+	return p
+}
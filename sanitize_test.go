@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestAllowHTML(t *testing.T) {
+	const body = "---\ntitle: Hello\n---\nHello <b>there</b>.\n\n<script>alert(1)</script>\n\n{{< youtube abc123 >}}\n\n<!--more-->\n\n<iframe src=\"https://evil.example.com/\"></iframe>\n"
+
+	for allowHTML, want := range map[bool][]string{
+		true:  {"<b>there</b>", "<script>alert(1)</script>", `src="https://www.youtube.com/embed/abc123"`, `<span id="more"></span>`, "https://evil.example.com/"},
+		false: {"<b>there</b>", `src="https://www.youtube.com/embed/abc123"`, `<span id="more"></span>`},
+	} {
+		config := defaultConfig()
+		config.AllowHTML = allowHTML
+		post := &Post{Index: &Index{config: config}}
+		if err := post.Read(context.Background(), "hello.md", []byte(body)); err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range want {
+			if !strings.Contains(string(post.Body), s) {
+				t.Errorf("with allowHTML %v got %q; want it to contain %q", allowHTML, post.Body, s)
+			}
+		}
+		if !allowHTML {
+			for _, s := range []string{"<script", "alert(1)", "evil.example.com"} {
+				if strings.Contains(string(post.Body), s) {
+					t.Errorf("got %q; want %q sanitized", post.Body, s)
+				}
+			}
+		}
+		if want := "/post/hello#more"; post.ReadMoreLink != want {
+			t.Errorf("got %q; want %q", post.ReadMoreLink, want)
+		}
+	}
+}
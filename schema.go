@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// fieldSchema declares the type of a frontmatter field and whether posts must
+// set it
+type fieldSchema struct {
+	Type     string
+	Required bool
+}
+
+// schemaTypes checks whether a frontmatter value is of the named type, dates
+// being in one of dateFormats
+var schemaTypes = map[string]func(v interface{}, dateFormats []string) bool{
+	"string": func(v interface{}, _ []string) bool { _, ok := v.(string); return ok },
+	"bool":   func(v interface{}, _ []string) bool { _, ok := v.(bool); return ok },
+	"int":    func(v interface{}, _ []string) bool { _, ok := v.(int); return ok },
+	"float": func(v interface{}, _ []string) bool {
+		switch v.(type) {
+		case int, float64:
+			return true
+		}
+		return false
+	},
+	"date": func(v interface{}, dateFormats []string) bool {
+		s, ok := v.(string)
+		if !ok {
+			return false
+		}
+		_, err := parseDate(s, dateFormats)
+		return err == nil
+	},
+	"list": func(v interface{}, _ []string) bool { _, ok := v.([]interface{}); return ok },
+	"map":  func(v interface{}, _ []string) bool { _, ok := v.(map[interface{}]interface{}); return ok },
+}
+
+// readSchema reads the schema setting, a map from field names to either a
+// type name or a map with type and required keys
+func readSchema(v interface{}) (map[string]fieldSchema, error) {
+	fields, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a map of fields, got %v", v)
+	}
+	schema := make(map[string]fieldSchema, len(fields))
+	for name, v := range fields {
+		var field fieldSchema
+		switch v := v.(type) {
+		case string:
+			field.Type = v
+		case map[interface{}]interface{}:
+			field.Type, _ = v["type"].(string)
+			field.Required, _ = v["required"].(bool)
+		default:
+			return nil, fmt.Errorf("field %v: unexpected value %v", name, v)
+		}
+		if _, ok := schemaTypes[field.Type]; !ok && field.Type != "" {
+			return nil, fmt.Errorf("field %v: unknown type %q", name, field.Type)
+		}
+		schema[fmt.Sprint(name)] = field
+	}
+	return schema, nil
+}
+
+// validateFrontmatter returns an error listing every field of frontmatter
+// that violates schema, dates being in one of dateFormats
+func validateFrontmatter(schema map[string]fieldSchema, dateFormats []string, frontmatter map[string]interface{}) error {
+	names := make([]string, 0, len(schema))
+	for name := range schema {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var violations []string
+	for _, name := range names {
+		field := schema[name]
+		v, ok := frontmatter[name]
+		if !ok {
+			if field.Required {
+				violations = append(violations, fmt.Sprintf("missing required field %q", name))
+			}
+			continue
+		}
+		if field.Type != "" && !schemaTypes[field.Type](v, dateFormats) {
+			violations = append(violations, fmt.Sprintf("field %q should be of type %s", name, field.Type))
+		}
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("%s", strings.Join(violations, "; "))
+	}
+	return nil
+}
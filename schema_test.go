@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSchema(t *testing.T) {
+	settings := strings.Replace(testSettings, "---\n", "---\nschema:\n  author:\n    type: string\n    required: true\n  rating: int\n", 1)
+	index := &Index{}
+	if err := index.ReadFrontmatter([]byte(settings)); err != nil {
+		t.Fatal(err)
+	}
+
+	for text, want := range map[string]string{
+		"---\ntitle: t\nauthor: Sina\nrating: 5\n---\nBody.\n":      "",
+		"---\ntitle: t\nauthor: Sina\n---\nBody.\n":                 "",
+		"---\ntitle: t\nrating: 5\n---\nBody.\n":                    `post.md: missing required field "author"`,
+		"---\ntitle: t\nauthor: Sina\nrating: high\n---\nBody.\n":   `post.md: field "rating" should be of type int`,
+		"---\ntitle: t\nauthor: [a, b]\nrating: high\n---\nBody.\n": `post.md: field "author" should be of type string; field "rating" should be of type int`,
+	} {
+		p := &Post{Index: index}
+		err := p.Read(context.Background(), "post.md", []byte(text))
+		if got := errorString(err); got != want {
+			t.Errorf("for %q got error %q; want %q", text, got, want)
+		}
+	}
+
+	if err := (&Index{}).ReadFrontmatter([]byte(strings.Replace(testSettings, "---\n", "---\nschema:\n  author: person\n", 1))); err == nil {
+		t.Error("got nil error for an unknown schema type")
+	}
+}
+
+func TestSchemaDateFormat(t *testing.T) {
+	settings := strings.Replace(testSettings, "---\n", "---\ndateformat: 02/01/2006\nschema:\n  date: date\n", 1)
+	index := &Index{}
+	if err := index.ReadFrontmatter([]byte(settings)); err != nil {
+		t.Fatal(err)
+	}
+
+	for text, want := range map[string]string{
+		"---\ntitle: t\ndate: 15/03/2024\n---\nBody.\n": "",
+		"---\ntitle: t\ndate: 2024-03-15\n---\nBody.\n": `post.md: field "date" should be of type date`,
+	} {
+		p := &Post{Index: index}
+		err := p.Read(context.Background(), "post.md", []byte(text))
+		if got := errorString(err); got != want {
+			t.Errorf("for %q got error %q; want %q", text, got, want)
+		}
+	}
+}
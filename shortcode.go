@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+)
+
+const (
+	shortcodesKeep  = "keep"
+	shortcodesError = "error"
+)
+
+// ShortcodeFunc expands a shortcode with the given arguments to HTML
+type ShortcodeFunc func(args []string) (string, error)
+
+// shortcodes holds the registered shortcodes by name
+var shortcodes = map[string]ShortcodeFunc{
+	"youtube": embedShortcode("https://www.youtube.com/embed/"),
+	"vimeo":   embedShortcode("https://player.vimeo.com/video/"),
+	"gist": func(args []string) (string, error) {
+		if len(args) != 2 {
+			return "", fmt.Errorf("expected a user and a gist ID, got %q", args)
+		}
+		src := "https://gist.github.com/" + url.PathEscape(args[0]) + "/" + url.PathEscape(args[1]) + ".js"
+		return `<script src="` + html.EscapeString(src) + `"></script>`, nil
+	},
+}
+
+// RegisterShortcode makes a shortcode available to posts as {{< name args >}}
+func RegisterShortcode(name string, fn ShortcodeFunc) {
+	shortcodes[name] = fn
+}
+
+// embedShortcode returns a shortcode embedding the video with the ID given as
+// its argument in an iframe
+func embedShortcode(prefix string) ShortcodeFunc {
+	return func(args []string) (string, error) {
+		if len(args) != 1 {
+			return "", fmt.Errorf("expected a video ID, got %q", args)
+		}
+		src := prefix + url.PathEscape(args[0])
+		return `<iframe src="` + html.EscapeString(src) + `" width="560" height="315" frameborder="0" allowfullscreen></iframe>`, nil
+	}
+}
+
+var (
+	shortcodeRe    = regexp.MustCompile(`\{\{<\s*([\w-]+)((?:\s+(?:"(?:[^"\\]|\\.)*"|[^\s">]+))*)\s*>\}\}`)
+	shortcodeArgRe = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|[^\s"]+`)
+)
+
+// expandShortcodes replaces the shortcodes in body with their HTML, except
+// those in code, which document them. Unknown shortcodes are left as they are
+// or are an error depending on unknown.
+func expandShortcodes(body []byte, unknown string) ([]byte, error) {
+	if unknown != shortcodesKeep && unknown != shortcodesError {
+		return nil, fmt.Errorf("unknown shortcodes setting %q", unknown)
+	}
+	if !bytes.Contains(body, []byte("{{<")) {
+		return body, nil
+	}
+	var expanded []byte
+	last := 0
+	for _, code := range codeRanges(body) {
+		text, err := expandText(body[last:code[0]], unknown)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(append(expanded, text...), body[code[0]:code[1]]...)
+		last = code[1]
+	}
+	text, err := expandText(body[last:], unknown)
+	if err != nil {
+		return nil, err
+	}
+	return append(expanded, text...), nil
+}
+
+// expandText replaces the shortcodes in text, which has no code
+func expandText(text []byte, unknown string) ([]byte, error) {
+	var err error
+	expanded := shortcodeRe.ReplaceAllFunc(text, func(m []byte) []byte {
+		if err != nil {
+			return m
+		}
+		sub := shortcodeRe.FindSubmatch(m)
+		name := string(sub[1])
+		fn, ok := shortcodes[name]
+		if !ok {
+			if unknown == shortcodesError {
+				err = fmt.Errorf("unknown shortcode %q", name)
+			}
+			return m
+		}
+		var args []string
+		for _, arg := range shortcodeArgRe.FindAllString(string(sub[2]), -1) {
+			if arg[0] == '"' {
+				if arg, err = strconv.Unquote(arg); err != nil {
+					err = fmt.Errorf("shortcode %q: %v", name, err)
+					return m
+				}
+			}
+			args = append(args, arg)
+		}
+		var s string
+		if s, err = fn(args); err != nil {
+			err = fmt.Errorf("shortcode %q: %v", name, err)
+			return m
+		}
+		return []byte(s)
+	})
+	return expanded, err
+}
+
+// codeRanges returns the start and end offsets of the fenced code blocks and
+// the code spans of the markdown body, in order
+func codeRanges(body []byte) [][2]int {
+	var ranges [][2]int
+	// text is where the code spans are looked for, up to the next fence
+	text := 0
+	var fence []byte
+	for start := 0; start < len(body); {
+		end := bytes.IndexByte(body[start:], '\n') + 1
+		if end == 0 {
+			end = len(body)
+		} else {
+			end += start
+		}
+		line := bytes.TrimLeft(body[start:end], " ")
+		switch {
+		case fence != nil:
+			if bytes.HasPrefix(line, fence) {
+				ranges = append(ranges, [2]int{text, end})
+				fence, text = nil, end
+			}
+		case bytes.HasPrefix(line, []byte("```")) || bytes.HasPrefix(line, []byte("~~~")):
+			ranges = append(ranges, codeSpans(body, text, start)...)
+			fence, text = line[:3], start
+		}
+		start = end
+	}
+	if fence != nil {
+		return append(ranges, [2]int{text, len(body)})
+	}
+	return append(ranges, codeSpans(body, text, len(body))...)
+}
+
+// codeSpans returns the ranges of the code spans in body[start:end], each
+// between backtick runs of the same length
+func codeSpans(body []byte, start, end int) [][2]int {
+	var spans [][2]int
+	for i := start; i < end; {
+		if body[i] != '`' {
+			i++
+			continue
+		}
+		n := i
+		for n < end && body[n] == '`' {
+			n++
+		}
+		run := body[i:n]
+		closing := -1
+		for j := n; j < end; {
+			k := bytes.Index(body[j:end], run)
+			if k < 0 {
+				break
+			}
+			k += j
+			// a longer run doesn't close the span
+			m := k + len(run)
+			for m < end && body[m] == '`' {
+				m++
+			}
+			if m-k == len(run) {
+				closing = m
+				break
+			}
+			j = m
+		}
+		if closing < 0 {
+			i = n
+			continue
+		}
+		spans = append(spans, [2]int{i, closing})
+		i = closing
+	}
+	return spans
+}
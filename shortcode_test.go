@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandShortcodes(t *testing.T) {
+	got, err := expandShortcodes([]byte("Watch this:\n\n{{< youtube abc123 >}}\n"), shortcodesKeep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Watch this:\n\n" + `<iframe src="https://www.youtube.com/embed/abc123" width="560" height="315" frameborder="0" allowfullscreen></iframe>` + "\n"
+	if string(got) != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+
+	RegisterShortcode("greet", func(args []string) (string, error) {
+		return "<b>" + strings.Join(args, "|") + "</b>", nil
+	})
+	defer delete(shortcodes, "greet")
+	if got, err := expandShortcodes([]byte(`{{<greet "hello world" you>}}`), shortcodesKeep); err != nil || string(got) != "<b>hello world|you</b>" {
+		t.Errorf("got %q, %v; want the registered shortcode expanded", got, err)
+	}
+
+	unknown := []byte("{{< nope 1 >}}")
+	if got, err := expandShortcodes(unknown, shortcodesKeep); err != nil || string(got) != string(unknown) {
+		t.Errorf("got %q, %v; want the unknown shortcode kept", got, err)
+	}
+	if _, err := expandShortcodes(unknown, shortcodesError); errorString(err) != `unknown shortcode "nope"` {
+		t.Errorf("got %v; want an unknown shortcode error", err)
+	}
+	if _, err := expandShortcodes([]byte("{{< youtube >}}"), shortcodesKeep); err == nil {
+		t.Error("got no error for a youtube shortcode without an ID")
+	}
+}
+
+func TestShortcodesInCode(t *testing.T) {
+	body := "Embed a video with `{{< youtube id >}}`, like:\n\n" +
+		"```\n{{< youtube abc123 >}}\n```\n\n" +
+		"{{< youtube abc123 >}}\n\n" +
+		"~~~\n{{< nope >}}\n~~~\n\n" +
+		"Not code: `` ` `` {{< youtube def456 >}}\n"
+	got, err := expandShortcodes([]byte(body), shortcodesError)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iframe := func(id string) string {
+		return `<iframe src="https://www.youtube.com/embed/` + id + `" width="560" height="315" frameborder="0" allowfullscreen></iframe>`
+	}
+	want := "Embed a video with `{{< youtube id >}}`, like:\n\n" +
+		"```\n{{< youtube abc123 >}}\n```\n\n" +
+		iframe("abc123") + "\n\n" +
+		"~~~\n{{< nope >}}\n~~~\n\n" +
+		"Not code: `` ` `` " + iframe("def456") + "\n"
+	if string(got) != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
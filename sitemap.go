@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	sitemapFilename = "sitemap.xml"
+	// sitemapTmplFilename is optional, without it the sitemap is encoded
+	// directly
+	sitemapTmplFilename = "sitemap.tmpl.xml"
+	sitemapXMLNS        = "http://www.sitemaps.org/schemas/sitemap/0.9"
+	w3cDateFormat       = "2006-01-02"
+)
+
+// sitemapSettings configures the entry of the index page in the sitemap
+type sitemapSettings struct {
+	ExcludeIndex bool
+	ChangeFreq   string
+	Priority     string
+}
+
+var sitemapChangeFreqs = map[string]bool{
+	"always": true, "hourly": true, "daily": true, "weekly": true,
+	"monthly": true, "yearly": true, "never": true,
+}
+
+// readSitemapSettings reads the sitemap setting, a map with index, changefreq
+// and priority keys
+func readSitemapSettings(v interface{}) (sitemapSettings, error) {
+	var settings sitemapSettings
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return settings, fmt.Errorf("expected a map, got %v", v)
+	}
+	if v, ok := m["index"]; ok {
+		include, ok := v.(bool)
+		if !ok {
+			return settings, fmt.Errorf("index: expected a boolean, got %v", v)
+		}
+		settings.ExcludeIndex = !include
+	}
+	if v, ok := m["changefreq"]; ok {
+		settings.ChangeFreq = fmt.Sprint(v)
+		if !sitemapChangeFreqs[settings.ChangeFreq] {
+			return settings, fmt.Errorf("changefreq: unknown value %q", settings.ChangeFreq)
+		}
+	}
+	if v, ok := m["priority"]; ok {
+		var priority float64
+		switch v := v.(type) {
+		case int:
+			priority = float64(v)
+		case float64:
+			priority = v
+		default:
+			return settings, fmt.Errorf("priority: expected a number, got %v", v)
+		}
+		if priority < 0 || priority > 1 {
+			return settings, fmt.Errorf("priority: %v is not between 0.0 and 1.0", priority)
+		}
+		settings.Priority = strconv.FormatFloat(priority, 'f', 1, 64)
+	}
+	return settings, nil
+}
+
+// sitemapURLSet is the sitemap, it is also the data of the sitemap template
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod,omitempty"`
+	ChangeFreq string `xml:"changefreq,omitempty"`
+	Priority   string `xml:"priority,omitempty"`
+}
+
+// sitemap returns the sitemap of the index page and the published posts that
+// allow indexing
+func sitemap(index *Index) sitemapURLSet {
+	urlset := sitemapURLSet{XMLNS: sitemapXMLNS}
+	if settings := index.sitemap; !settings.ExcludeIndex {
+		urlset.URLs = append(urlset.URLs, sitemapURL{
+			Loc:        index.URL,
+			ChangeFreq: settings.ChangeFreq,
+			Priority:   settings.Priority,
+		})
+	}
+	for _, post := range index.Posts {
+		if post.Draft || post.NoIndex() {
+			continue
+		}
+		u := sitemapURL{Loc: post.Link}
+		// revised posts are crawled again
+		lastMod := post.Updated
+		if lastMod.IsZero() {
+			lastMod = post.Date
+		}
+		if !lastMod.IsZero() {
+			u.LastMod = lastMod.Format(w3cDateFormat)
+		}
+		urlset.URLs = append(urlset.URLs, u)
+	}
+	return urlset
+}
+
+// writeSitemap writes the sitemap of index
+func writeSitemap(w io.Writer, index *Index) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(sitemap(index)); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
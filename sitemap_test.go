@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestSitemapIndexEntry(t *testing.T) {
+	indexEntry := "<url>\n    <loc>https://example.com/</loc>"
+	for settings, want := range map[string]string{
+		"":                          indexEntry + "\n  </url>",
+		"sitemap:\n  index: true\n": indexEntry + "\n  </url>",
+		"sitemap:\n  changefreq: daily\n  priority: 1\n": indexEntry + "\n    <changefreq>daily</changefreq>\n    <priority>1.0</priority>\n  </url>",
+		"sitemap:\n  index: false\n":                     "",
+	} {
+		index := &Index{}
+		if err := index.ReadFrontmatter([]byte(strings.Replace(testSettings, "---\n", "---\n"+settings, 1))); err != nil {
+			t.Fatal(err)
+		}
+		index.Posts = []*Post{
+			{Link: "https://example.com/post/hello", Date: time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC)},
+			{Link: "https://example.com/post/revised", Date: time.Date(2017, 1, 3, 0, 0, 0, 0, time.UTC), Updated: time.Date(2018, 5, 6, 0, 0, 0, 0, time.UTC)},
+			{Link: "https://example.com/post/draft", Draft: true},
+		}
+
+		var buf bytes.Buffer
+		if err := writeSitemap(&buf, index); err != nil {
+			t.Fatal(err)
+		}
+		got := buf.String()
+		if err := xml.Unmarshal(buf.Bytes(), new(sitemapURLSet)); err != nil {
+			t.Errorf("got invalid XML %q: %v", got, err)
+		}
+		if want == "" {
+			if strings.Contains(got, indexEntry) {
+				t.Errorf("for %q got %q; want no index entry", settings, got)
+			}
+		} else if !strings.Contains(got, want) {
+			t.Errorf("for %q got %q; want it to contain %q", settings, got, want)
+		}
+		for _, want := range []string{
+			"<loc>https://example.com/post/hello</loc>\n    <lastmod>2017-01-02</lastmod>",
+			"<loc>https://example.com/post/revised</loc>\n    <lastmod>2018-05-06</lastmod>",
+		} {
+			if !strings.Contains(got, want) {
+				t.Errorf("got %q; want it to contain %q", got, want)
+			}
+		}
+		if strings.Contains(got, "draft") {
+			t.Errorf("got %q; want drafts excluded", got)
+		}
+	}
+
+	for _, settings := range []string{
+		"sitemap:\n  changefreq: sometimes\n",
+		"sitemap:\n  priority: 2\n",
+		"sitemap:\n  index: maybe\n",
+	} {
+		if err := (&Index{}).ReadFrontmatter([]byte(strings.Replace(testSettings, "---\n", "---\n"+settings, 1))); err == nil {
+			t.Errorf("for %q got nil error", settings)
+		}
+	}
+}
+
+func TestSitemapNoIndex(t *testing.T) {
+	index := &Index{URL: "https://example.com/"}
+	var posts []*Post
+	for name, text := range map[string]string{
+		"public.md":   "---\ntitle: Public\n---\nPublic.\n",
+		"thanks.md":   "---\ntitle: Thanks\nrobots: noindex, nofollow\n---\nThanks.\n",
+		"nofollow.md": "---\ntitle: Followed\nrobots: nofollow\n---\nNot followed.\n",
+	} {
+		p := &Post{Index: index}
+		if err := p.Read(context.Background(), name, []byte(text)); err != nil {
+			t.Fatal(err)
+		}
+		posts = append(posts, p)
+	}
+	index.Posts = posts
+
+	var buf bytes.Buffer
+	if err := writeSitemap(&buf, index); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	for _, want := range []string{"/post/public", "/post/nofollow"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got %q; want it to contain %q", got, want)
+		}
+	}
+	if strings.Contains(got, "/post/thanks") {
+		t.Errorf("got %q; want the noindex post omitted", got)
+	}
+
+	tmpl := template.Must(template.New("").Funcs(templateFuncs(defaultConfig().assetsURL(), nil)).ParseFiles(path.Join("example", "templates", postTmplFilename)))
+	for _, p := range posts {
+		var page bytes.Buffer
+		if err := tmpl.ExecuteTemplate(&page, postTmplFilename, p); err != nil {
+			t.Fatal(err)
+		}
+		meta := `<meta name="robots" content="noindex, nofollow">`
+		if got, want := strings.Contains(page.String(), meta), p.Slug == "thanks"; got != want {
+			t.Errorf("for %q got meta tag %v; want %v", p.Slug, got, want)
+		}
+	}
+	if err := (&Post{Index: index}).Read(context.Background(), "bad.md", []byte("---\ntitle: Bad\nrobots: [noindex]\n---\nBad.\n")); errorString(err) != "bad.md: invalid robots: expected a string, got [noindex]" {
+		t.Errorf("got %v; want an invalid robots error", err)
+	}
+}
+
+func TestSitemapTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		settingsFilename: strings.Replace(testSettings, "---\n", "---\nsitemap:\n  changefreq: daily\n", 1),
+		"hello.md":       "---\ntitle: Hello\ndate: 2017-01-02\n---\nHello.\n",
+		"pending.md":     "---\ntitle: Pending\ndate: 2017-01-03\ndraft: true\n---\nPending.\n",
+	})
+	tmpl, err := ioutil.ReadFile(path.Join("example", "templates", sitemapTmplFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(config.TemplatesPath, sitemapTmplFilename), tmpl, 0644); err != nil {
+		t.Fatal(err)
+	}
+	config.Preview = true
+	if _, err := buildAll(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ioutil.ReadFile(path.Join(config.OutputPath, sitemapFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var urlset sitemapURLSet
+	if err := xml.Unmarshal(got, &urlset); err != nil {
+		t.Fatalf("got invalid XML %q: %v", got, err)
+	}
+	want := []sitemapURL{
+		{Loc: "https://example.com/", ChangeFreq: "daily"},
+		{Loc: "https://example.com/post/hello", LastMod: "2017-01-02"},
+	}
+	if !reflect.DeepEqual(urlset.URLs, want) {
+		t.Errorf("got %+v; want %+v", urlset.URLs, want)
+	}
+}
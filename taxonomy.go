@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	tagTmplFilename = "tag.tmpl.html"
+	tagsTaxonomy    = "tags"
+)
+
+// taxonomySettings are the settings of the listing pages of a taxonomy
+type taxonomySettings struct {
+	// Sort is the order of the posts, a key of postOrders
+	Sort string
+}
+
+// postOrders are the orders posts can be listed in. Each reports whether a is
+// listed before b.
+var postOrders = map[string]func(a, b *Post) bool{
+	"date":  func(a, b *Post) bool { return a.Date.After(b.Date) },
+	"title": func(a, b *Post) bool { return strings.ToLower(a.Title) < strings.ToLower(b.Title) },
+}
+
+// readTaxonomySettings reads the taxonomies setting, a map from taxonomy
+// names to maps with a sort key
+func readTaxonomySettings(v interface{}) (map[string]taxonomySettings, error) {
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a map, got %v", v)
+	}
+	taxonomies := make(map[string]taxonomySettings, len(m))
+	for name, v := range m {
+		if name != tagsTaxonomy {
+			return nil, fmt.Errorf("unknown taxonomy %q", name)
+		}
+		fields, ok := v.(map[interface{}]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%v: expected a map, got %v", name, v)
+		}
+		var settings taxonomySettings
+		if v, ok := fields["sort"]; ok {
+			settings.Sort = fmt.Sprint(v)
+			if _, ok := postOrders[settings.Sort]; !ok {
+				return nil, fmt.Errorf("%v: unknown sort %q", name, settings.Sort)
+			}
+		}
+		taxonomies[tagsTaxonomy] = settings
+	}
+	return taxonomies, nil
+}
+
+var slugRe = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+// slugify returns the form of s used in filenames and URLs, e.g.
+// "Go Programming" becomes "go-programming". Letters and digits of any
+// script are kept.
+func slugify(s string) string {
+	return strings.Trim(slugRe.ReplaceAllString(strings.ToLower(s), "-"), "-")
+}
+
+// Tags returns the sorted tags of the non-draft posts, e.g. for a tag cloud.
+// Tags with the same page, e.g. "Go" and "go", are listed once, as they are
+// written in the newest post.
+func (index *Index) Tags() []string {
+	seen := make(map[string]bool)
+	var tags []string
+	for _, post := range index.Posts {
+		if post.Draft {
+			continue
+		}
+		for _, tag := range post.Tags {
+			if slug := slugify(tag); !seen[slug] {
+				seen[slug] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// tagConflicts returns a message for each tag page shared by tags of
+// non-draft posts that differ by more than case, e.g. "C++" and "C#"
+func tagConflicts(posts []*Post) []string {
+	names := make(map[string][]string)
+	var filenames []string
+	for _, post := range posts {
+		if post.Draft {
+			continue
+		}
+		for _, tag := range post.Tags {
+			filename := tagFilename(tag)
+			if _, ok := names[filename]; !ok {
+				filenames = append(filenames, filename)
+			}
+			found := false
+			for _, name := range names[filename] {
+				found = found || strings.EqualFold(name, tag)
+			}
+			if !found {
+				names[filename] = append(names[filename], tag)
+			}
+		}
+	}
+
+	var conflicts []string
+	for _, filename := range filenames {
+		if len(names[filename]) > 1 {
+			var quoted []string
+			for _, name := range names[filename] {
+				quoted = append(quoted, fmt.Sprintf("%q", name))
+			}
+			sort.Strings(quoted)
+			conflicts = append(conflicts, fmt.Sprintf("tags %s share %s", strings.Join(quoted, ", "), filename))
+		}
+	}
+	return conflicts
+}
+
+// tagFilename returns the path of the page of tag relative to the output path
+func tagFilename(tag string) string {
+	return path.Join("tag", slugify(tag)+".html")
+}
+
+// TagLink returns the link to the page of tag, e.g. for the tags of a post
+func (index *Index) TagLink(tag string) string {
+	return index.link(tagFilename(tag))
+}
+
+// tagIndex returns a copy of the index listing the non-draft posts with a
+// tag of the same page as tag, in the order configured for tags
+func (index *Index) tagIndex(tag string) *Index {
+	slug := slugify(tag)
+	tagged := index.filter(func(post *Post) bool {
+		if post.Draft {
+			return false
+		}
+		for _, t := range post.Tags {
+			if slugify(t) == slug {
+				return true
+			}
+		}
+		return false
+	})
+	tagged.Tag = tag
+	if order, ok := postOrders[index.taxonomies[tagsTaxonomy].Sort]; ok {
+		sort.SliceStable(tagged.Posts, func(i, j int) bool {
+			return order(tagged.Posts[i], tagged.Posts[j])
+		})
+	}
+	return tagged
+}
+
+// writeTagPages renders the page of each tag into outputPath with the tag
+// template and returns their paths relative to outputPath
+func writeTagPages(tmpl templateSet, outputPath string, index *Index) ([]string, error) {
+	var generated []string
+	tags := index.Tags()
+	if len(tags) > 0 {
+		if err := os.MkdirAll(path.Join(outputPath, "tag"), 0755); err != nil {
+			return nil, err
+		}
+	}
+	for _, tag := range tags {
+		filename := tagFilename(tag)
+		if err := executeTemplateFile(tmpl, path.Join(outputPath, filename), tagTmplFilename, index.tagIndex(tag)); err != nil {
+			return nil, err
+		}
+		generated = append(generated, filename)
+	}
+	return generated, nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestTagPageSort(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		settingsFilename: strings.Replace(testSettings, "---\n", "---\ntaxonomies:\n  tags:\n    sort: title\n", 1),
+		"b.md":           "---\ntitle: Banana\ndate: 2017-01-01\ntags: [Go Programming]\n---\nB.\n",
+		"a.md":           "---\ntitle: Apple\ndate: 2017-01-02\ntags: [Go Programming, food]\n---\nA.\n",
+		"c.md":           "---\ntitle: Cherry\ndate: 2017-01-03\ntags: [Go Programming]\n---\nC.\n",
+		"d.md":           "---\ntitle: Draft\ndate: 2017-01-04\ntags: [Go Programming]\ndraft: true\n---\nD.\n",
+	})
+	if err := ioutil.WriteFile(path.Join(config.TemplatesPath, tagTmplFilename), []byte("{{.Tag}}:{{range .Posts}} {{.Title}}{{end}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	generated, err := buildAll(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for filename, want := range map[string]string{
+		"tag/go-programming.html": "Go Programming: Apple Banana Cherry",
+		"tag/food.html":           "food: Apple",
+		"index.html":              "Cherry\nApple\nBanana\n",
+	} {
+		got, err := ioutil.ReadFile(path.Join(config.OutputPath, filename))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s: got %q; want %q", filename, got, want)
+		}
+	}
+	if !strings.Contains(strings.Join(generated, " "), "tag/food.html tag/go-programming.html") {
+		t.Errorf("got generated %q; want the tag pages", generated)
+	}
+}
+
+func TestTagLinks(t *testing.T) {
+	config := defaultConfig()
+	config.Subdir = "preview"
+	index := &Index{config: config}
+	for name, text := range map[string]string{
+		"a.md": "---\ntitle: A\ntags: [Go Programming, blog]\n---\nA.\n",
+		"b.md": "---\ntitle: B\ntags: go\n---\nB.\n",
+		"c.md": "---\ntitle: C\ntags: [secret]\ndraft: true\n---\nC.\n",
+	} {
+		post := &Post{Index: index}
+		if err := post.Read(context.Background(), name, []byte(text)); err != nil {
+			t.Fatal(err)
+		}
+		index.Posts = append(index.Posts, post)
+	}
+	if got, want := index.Tags(), []string{"Go Programming", "blog", "go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got tags %q; want %q", got, want)
+	}
+
+	tmpl := template.Must(template.New("").Parse(`{{range .Tags}}<a href="{{$.Index.TagLink .}}">{{.}}</a>{{end}}`))
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, &Post{Index: index, Tags: []string{"Go Programming", "blog"}}); err != nil {
+		t.Fatal(err)
+	}
+	if want := `<a href="/preview/tag/go-programming.html">Go Programming</a><a href="/preview/tag/blog.html">blog</a>`; buf.String() != want {
+		t.Errorf("got %q; want %q", buf.String(), want)
+	}
+}
+
+func TestSlugify(t *testing.T) {
+	for s, want := range map[string]string{
+		"Go Programming": "go-programming",
+		"  C++ ":         "c",
+		"日本語":            "日本語",
+		"Café Noir":      "café-noir",
+		"Go 1.22":        "go-1-22",
+	} {
+		if got := slugify(s); got != want {
+			t.Errorf("slugify(%q) = %q; want %q", s, got, want)
+		}
+	}
+}
+
+func TestTagPagesBySlug(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"a.md": "---\ntitle: A\ndate: 2017-01-01\ntags: [go, 日本語]\n---\nA.\n",
+		"b.md": "---\ntitle: B\ndate: 2017-01-02\ntags: [Go, 中文]\n---\nB.\n",
+		"c.md": "---\ntitle: C\ndate: 2017-01-03\ntags: [C++]\n---\nC.\n",
+		"d.md": "---\ntitle: D\ndate: 2017-01-04\ntags: [C#]\n---\nD.\n",
+	})
+	if err := ioutil.WriteFile(path.Join(config.TemplatesPath, tagTmplFilename), []byte("{{.Tag}}:{{range .Posts}} {{.Title}}{{end}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	logs, restore := captureLogs(logNormal)
+	defer restore()
+	generated, err := buildAll(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(strings.Join(generated, " "), "tag/go.html"); got != 1 {
+		t.Errorf("got generated %q; want tag/go.html once", generated)
+	}
+	for filename, want := range map[string]string{
+		"tag/go.html":  "Go: B A",
+		"tag/日本語.html": "日本語: A",
+		"tag/中文.html":  "中文: B",
+	} {
+		got, err := ioutil.ReadFile(path.Join(config.OutputPath, filename))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s: got %q; want %q", filename, got, want)
+		}
+	}
+	want := `warning: tags "C#", "C++" share tag/c.html`
+	if got := logs.String(); !strings.Contains(got, want) || strings.Count(got, "share") != 1 {
+		t.Errorf("got logs %q; want exactly one warning %q", got, want)
+	}
+
+	config.Strict = true
+	if _, err := buildAll(context.Background(), config); errorString(err) != want[len("warning: "):] {
+		t.Errorf("got error %v; want the tag conflict in strict mode", err)
+	}
+}
+
+func TestReadTaxonomySettings(t *testing.T) {
+	for settings, wantErr := range map[string]string{
+		"taxonomies:\n  tags:\n    sort: date\n":   "",
+		"taxonomies:\n  tags:\n    sort: views\n":  `invalid taxonomies: tags: unknown sort "views"`,
+		"taxonomies:\n  colors:\n    sort: date\n": `invalid taxonomies: unknown taxonomy "colors"`,
+	} {
+		index := &Index{}
+		err := index.ReadFrontmatter([]byte(strings.Replace(testSettings, "---\n", "---\n"+settings, 1)))
+		if got := errorString(err); got != wantErr {
+			t.Errorf("for %q got error %q; want %q", settings, got, wantErr)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	htmlTokenRe = regexp.MustCompile(`<[^>]*>|&[#\w]+;|[^<&]+|[<&]`)
+	tagNameRe   = regexp.MustCompile(`^</?([a-zA-Z][a-zA-Z0-9]*)`)
+)
+
+// voidElements have no closing tag
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "param": true, "source": true, "track": true, "wbr": true,
+}
+
+// truncateHTML cuts s to at most n bytes, not counting the closing tags it
+// adds for the elements left open at the cut. Tags and entities are never
+// cut. It reports whether s was cut.
+func truncateHTML(s string, n int) (string, bool) {
+	if len(s) <= n {
+		return s, false
+	}
+	var b strings.Builder
+	var open []string
+	for _, token := range htmlTokenRe.FindAllString(s, -1) {
+		if b.Len()+len(token) > n {
+			if token[0] != '<' && token[0] != '&' {
+				// cut the text on a rune boundary
+				text := token[:n-b.Len()]
+				for len(text) > 0 && !utf8.ValidString(text) {
+					text = text[:len(text)-1]
+				}
+				b.WriteString(text)
+			}
+			break
+		}
+		b.WriteString(token)
+		m := tagNameRe.FindStringSubmatch(token)
+		if m == nil || strings.HasPrefix(token, "<!") {
+			continue
+		}
+		name := strings.ToLower(m[1])
+		switch {
+		case voidElements[name] || strings.HasSuffix(token, "/>"):
+		case token[1] == '/':
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] == name {
+					open = open[:i]
+					break
+				}
+			}
+		default:
+			open = append(open, name)
+		}
+	}
+	for i := len(open) - 1; i >= 0; i-- {
+		b.WriteString("</" + open[i] + ">")
+	}
+	return b.String(), true
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestTruncateHTML(t *testing.T) {
+	for _, test := range []struct {
+		html string
+		n    int
+		want string
+		cut  bool
+	}{
+		{"<p>short</p>", 100, "<p>short</p>", false},
+		{"<p>Hello <b>big</b> world</p>", 13, "<p>Hello <b>b</b></p>", true},
+		{"<p>a<br/>b &amp; c</p><p>d</p>", 12, "<p>a<br/>b </p>", true},
+		{"<ul><li>héllo</li></ul>", 10, "<ul><li>h</li></ul>", true},
+	} {
+		got, cut := truncateHTML(test.html, test.n)
+		if got != test.want || cut != test.cut {
+			t.Errorf("truncateHTML(%q, %d) = %q, %v; want %q, %v", test.html, test.n, got, cut, test.want, test.cut)
+		}
+	}
+}
+
+func TestFeedBodyLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := newTestSite(t, dir, map[string]string{
+		"long.md":  "---\ntitle: Long\ndate: 2017-01-01\n---\nThis post has a **long** body that does not fit.\n",
+		"short.md": "---\ntitle: Short\ndate: 2017-01-02\n---\nShort.\n",
+	})
+	config.FeedBodyLimit = 30
+	if err := ioutil.WriteFile(path.Join(config.TemplatesPath, feedTmplFilename), []byte("<rss>{{range .Posts}}<item><![CDATA[{{.FeedBody}}]]></item>{{end}}</rss>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buildAll(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(path.Join(config.OutputPath, "index.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := xml.Header + "<rss>" +
+		"<item><![CDATA[<p>Short.</p>\n]]></item>" +
+		`<item><![CDATA[<p>This post has a <strong>lon</strong></p><p><a href="https://example.com/post/long">Read more</a></p>]]></item>` +
+		"</rss>"
+	if string(got) != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}